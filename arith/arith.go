@@ -0,0 +1,330 @@
+// Package arith implements adaptive arithmetic coding over bit streams.
+//
+// An Encoder represents a sequence of binary decisions and symbols as a
+// single binary fraction, written to a bitstream.Writer, and a Decoder
+// recovers them from a bitstream.Reader.  Each decision or symbol is coded
+// with a probability model, which adapts as values are coded, so that the
+// code approaches the entropy of the data as the models learn its statistics.
+// The encoder and decoder must use equivalent models, in the same sequence.
+//
+// Binary decisions are coded with a BitModel, as in the CABAC coder of H.264.
+// Symbols from a larger alphabet are coded with a Model, which gives each
+// symbol an interval of cumulative frequencies, as in a range coder.  This
+// package provides the adaptive models AdaptiveBit and FrequencyModel, and
+// callers may supply their own implementations of either interface.
+//
+// The coder works in exact integer arithmetic, with 32 bits of precision, so
+// its output depends only on the values coded and the models used.  The code
+// is emitted one bit at a time.  A carry that would propagate into bits not
+// yet known is handled by counting the outstanding bits, and emitting them
+// once the carry is resolved.
+//
+// The encoder finishes the code by writing 32 bits, which is exactly the
+// number of bits the decoder reads ahead.  Thus after the decoder has read the
+// last value, the Reader is positioned at the end of the code, and the caller
+// can continue to read any data that follows it in the stream.
+package arith
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/creachadair/bitstream"
+)
+
+// ErrModel is reported when a model reports an invalid probability, total,
+// or interval.
+var ErrModel = errors.New("arith: invalid model")
+
+// ErrClosed is reported when encoding with an Encoder that has been closed.
+var ErrClosed = errors.New("arith: encoder is closed")
+
+const (
+	codeBits = 32 // the precision of the coder
+	topValue = 1<<codeBits - 1
+	half     = 1 << (codeBits - 1)
+	quarter  = 1 << (codeBits - 2)
+)
+
+// MaxTotal is the largest total frequency a Model may report.  The width of
+// the coding interval is always greater than MaxTotal, so every symbol with a
+// nonzero frequency receives a nonempty subinterval.
+const MaxTotal = quarter
+
+// An Encoder writes arithmetic-coded values to a bitstream.Writer.  The
+// caller must call Close when finished to complete the code.
+type Encoder struct {
+	w   *bitstream.Writer
+	err error // if non-nil, the error to report for further encoding
+
+	// The current interval is [low, high], scaled so that the 32 bits of each
+	// are the bits of the code following those already written.
+	low, high uint64
+
+	// The number of outstanding bits, which follow the next bit written and
+	// are its complement.
+	pending int
+}
+
+// NewEncoder returns an Encoder that writes to w.
+func NewEncoder(w *bitstream.Writer) *Encoder {
+	return &Encoder{w: w, high: topValue}
+}
+
+// EncodeBit encodes a binary decision with the model m, and then updates m.
+func (e *Encoder) EncodeBit(m BitModel, bit bool) error {
+	p0, err := bitProb(m)
+	if err != nil {
+		return err
+	}
+	lo, hi := uint64(0), p0
+	if bit {
+		lo, hi = p0, 1<<ProbBits
+	}
+	if err := e.encode(lo, hi, 1<<ProbBits); err != nil {
+		return err
+	}
+	m.Update(bit)
+	return nil
+}
+
+// Encode encodes the symbol sym with the model m, and then updates m.
+func (e *Encoder) Encode(m Model, sym int) error {
+	total, err := modelTotal(m)
+	if err != nil {
+		return err
+	}
+	lo, hi := m.Interval(sym)
+	if lo >= hi || hi > total {
+		return fmt.Errorf("%w: interval [%d, %d) for symbol %d, total %d", ErrModel, lo, hi, sym, total)
+	}
+	if err := e.encode(uint64(lo), uint64(hi), uint64(total)); err != nil {
+		return err
+	}
+	m.Update(sym)
+	return nil
+}
+
+// Close writes the final bits of the code, and reports any error from
+// encoding.  It does not flush the underlying writer.  After Close succeeds,
+// further encoding reports ErrClosed.
+func (e *Encoder) Close() error {
+	if e.err == ErrClosed {
+		return nil
+	} else if e.err != nil {
+		return e.err
+	}
+
+	// Any value in the final interval identifies it; write the low end.
+	e.err = e.emit(e.low&half != 0)
+	for i := codeBits - 2; i >= 0 && e.err == nil; i-- {
+		e.err = e.w.WriteBit(e.low>>i&1 != 0)
+	}
+	if e.err != nil {
+		return e.err
+	}
+	e.err = ErrClosed
+	return nil
+}
+
+// encode narrows the current interval to the subinterval [lo, hi) of total,
+// and writes any bits of the code that are thereby determined.
+func (e *Encoder) encode(lo, hi, total uint64) error {
+	if e.err != nil {
+		return e.err
+	}
+	r := e.high - e.low + 1
+	e.high = e.low + r*hi/total - 1
+	e.low += r * lo / total
+
+	// Double the width of the interval until it exceeds a quarter of the code
+	// space, writing the leading bit each time it is settled.
+	for {
+		switch {
+		case e.high < half:
+			e.err = e.emit(false)
+		case e.low >= half:
+			e.err = e.emit(true)
+			e.low -= half
+			e.high -= half
+		case e.low >= quarter && e.high < 3*quarter:
+			// The interval straddles the midpoint, so the leading bit is not yet
+			// known, but the bit after it will be its complement.
+			e.pending++
+			e.low -= quarter
+			e.high -= quarter
+		default:
+			return nil
+		}
+		if e.err != nil {
+			return e.err
+		}
+		e.low <<= 1
+		e.high = e.high<<1 | 1
+	}
+}
+
+// emit writes bit, followed by the outstanding bits.
+func (e *Encoder) emit(bit bool) error {
+	if err := e.w.WriteBit(bit); err != nil {
+		return err
+	}
+	var fill uint64
+	if !bit {
+		fill = ^uint64(0)
+	}
+	for e.pending > 0 {
+		n := min(e.pending, 64)
+		if _, err := e.w.WriteBits(n, fill>>(64-n)); err != nil {
+			return err
+		}
+		e.pending -= n
+	}
+	return nil
+}
+
+// A Decoder reads arithmetic-coded values from a bitstream.Reader.
+type Decoder struct {
+	r   *bitstream.Reader
+	err error // if non-nil, the error to report for further decoding
+
+	// The current interval is [low, high], scaled as for the Encoder, and
+	// value holds the next 32 bits of the code, which lie within it.
+	low, high, value uint64
+}
+
+// NewDecoder returns a Decoder that reads from r.  NewDecoder reads the first
+// 32 bits of the code from r immediately; if this fails, the error is
+// reported by the first call to decode a value.
+func NewDecoder(r *bitstream.Reader) *Decoder {
+	d := &Decoder{r: r, high: topValue}
+	for range codeBits {
+		if d.err = d.shift(); d.err != nil {
+			break
+		}
+	}
+	return d
+}
+
+// DecodeBit decodes a binary decision with the model m, and then updates m.
+// If the stream ends before the code is complete, DecodeBit reports
+// io.ErrUnexpectedEOF.
+func (d *Decoder) DecodeBit(m BitModel) (bool, error) {
+	p0, err := bitProb(m)
+	if err != nil {
+		return false, err
+	}
+	v, err := d.target(1 << ProbBits)
+	if err != nil {
+		return false, err
+	}
+	bit := v >= p0
+	lo, hi := uint64(0), p0
+	if bit {
+		lo, hi = p0, 1<<ProbBits
+	}
+	if err := d.decode(lo, hi, 1<<ProbBits); err != nil {
+		return false, err
+	}
+	m.Update(bit)
+	return bit, nil
+}
+
+// Decode decodes a symbol with the model m, and then updates m.  If the
+// stream ends before the code is complete, Decode reports
+// io.ErrUnexpectedEOF.
+func (d *Decoder) Decode(m Model) (int, error) {
+	total, err := modelTotal(m)
+	if err != nil {
+		return 0, err
+	}
+	v, err := d.target(uint64(total))
+	if err != nil {
+		return 0, err
+	}
+	sym, lo, hi := m.Find(uint32(v))
+	if uint64(lo) > v || uint64(hi) <= v || hi > total {
+		return 0, fmt.Errorf("%w: interval [%d, %d) found for %d, total %d", ErrModel, lo, hi, v, total)
+	}
+	if err := d.decode(uint64(lo), uint64(hi), uint64(total)); err != nil {
+		return 0, err
+	}
+	m.Update(sym)
+	return sym, nil
+}
+
+// target returns the cumulative frequency, out of total, at which the code
+// lies within the current interval.
+func (d *Decoder) target(total uint64) (uint64, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	r := d.high - d.low + 1
+	return ((d.value-d.low+1)*total - 1) / r, nil
+}
+
+// decode narrows the current interval to the subinterval [lo, hi) of total,
+// and reads the bits of the code that replace those thereby determined.
+func (d *Decoder) decode(lo, hi, total uint64) error {
+	r := d.high - d.low + 1
+	d.high = d.low + r*hi/total - 1
+	d.low += r * lo / total
+
+	// Scale the interval exactly as the Encoder did.
+	for {
+		switch {
+		case d.high < half:
+		case d.low >= half:
+			d.low -= half
+			d.high -= half
+			d.value -= half
+		case d.low >= quarter && d.high < 3*quarter:
+			d.low -= quarter
+			d.high -= quarter
+			d.value -= quarter
+		default:
+			return nil
+		}
+		d.low <<= 1
+		d.high = d.high<<1 | 1
+		if d.err = d.shift(); d.err != nil {
+			return d.err
+		}
+	}
+}
+
+// shift shifts the next bit of the code into value.
+func (d *Decoder) shift() error {
+	bit, err := d.r.ReadBit()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	d.value <<= 1
+	if bit {
+		d.value |= 1
+	}
+	return nil
+}
+
+// bitProb returns the probability of a zero reported by m, or an error if it
+// is out of range.
+func bitProb(m BitModel) (uint64, error) {
+	p0 := m.P0()
+	if p0 == 0 || p0 >= 1<<ProbBits {
+		return 0, fmt.Errorf("%w: probability %d out of range", ErrModel, p0)
+	}
+	return uint64(p0), nil
+}
+
+// modelTotal returns the total frequency reported by m, or an error if it is
+// out of range.
+func modelTotal(m Model) (uint32, error) {
+	total := m.Total()
+	if total == 0 || total > MaxTotal {
+		return 0, fmt.Errorf("%w: total %d out of range", ErrModel, total)
+	}
+	return total, nil
+}
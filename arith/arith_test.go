@@ -0,0 +1,241 @@
+package arith_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/arith"
+)
+
+var optionSets = []*bitstream.Options{
+	nil,
+	{LowBitFirst: true},
+	{LowBitFirst: true, FieldLowBitFirst: true},
+}
+
+// A value is a binary decision or a symbol to be coded.
+type value struct {
+	isBit bool
+	bit   bool
+	sym   int
+}
+
+// models are the models used to code a sequence of values.  Decisions
+// alternate between two contexts, as in CABAC.
+type models struct {
+	bits [2]*arith.AdaptiveBit
+	syms *arith.FrequencyModel
+}
+
+func newModels(nsym int) *models {
+	return &models{
+		bits: [2]*arith.AdaptiveBit{arith.NewAdaptiveBit(4), arith.NewAdaptiveBit(6)},
+		syms: arith.NewFrequencyModel(nsym, 0, 0),
+	}
+}
+
+// encode returns the coding of values, followed by a 5-bit trailer.
+func encode(t *testing.T, values []value, nsym int, opts *bitstream.Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := bitstream.NewWriter(&buf, opts)
+	e := arith.NewEncoder(w)
+	m := newModels(nsym)
+	for i, v := range values {
+		var err error
+		if v.isBit {
+			err = e.EncodeBit(m.bits[i%2], v.bit)
+		} else {
+			err = e.Encode(m.syms, v.sym)
+		}
+		if err != nil {
+			t.Fatalf("Encode %d: unexpected error: %v", i, err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	if _, err := w.WriteBits(5, 0x15); err != nil {
+		t.Fatalf("WriteBits: unexpected error: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: unexpected error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// decode checks that data decodes to values, followed by the trailer.
+func decode(t *testing.T, data []byte, values []value, nsym int, opts *bitstream.Options) {
+	t.Helper()
+	r := bitstream.NewReader(bytes.NewReader(data), opts)
+	d := arith.NewDecoder(r)
+	m := newModels(nsym)
+	for i, v := range values {
+		if v.isBit {
+			got, err := d.DecodeBit(m.bits[i%2])
+			if err != nil || got != v.bit {
+				t.Fatalf("DecodeBit %d: got (%v, %v), want (%v, nil)", i, got, err, v.bit)
+			}
+		} else {
+			got, err := d.Decode(m.syms)
+			if err != nil || got != v.sym {
+				t.Fatalf("Decode %d: got (%v, %v), want (%v, nil)", i, got, err, v.sym)
+			}
+		}
+	}
+	var trailer uint64
+	if _, err := r.ReadBits(5, &trailer); err != nil || trailer != 0x15 {
+		t.Errorf("ReadBits trailer: got (%#x, %v), want (0x15, nil)", trailer, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	mixed := make([]value, 20000)
+	for i := range mixed {
+		if rng.Intn(3) == 0 {
+			mixed[i] = value{sym: int(rng.ExpFloat64()*3) % 40}
+		} else {
+			mixed[i] = value{isBit: true, bit: rng.Intn(10) == 0}
+		}
+	}
+	allZero := make([]value, 5000)
+	for i := range allZero {
+		allZero[i] = value{isBit: true}
+	}
+	uniform := make([]value, 5000)
+	for i := range uniform {
+		uniform[i] = value{sym: rng.Intn(40)}
+	}
+	tests := map[string][]value{
+		"empty":    nil,
+		"one bit":  {{isBit: true, bit: true}},
+		"one sym":  {{sym: 39}},
+		"mixed":    mixed,
+		"all zero": allZero,
+		"uniform":  uniform,
+	}
+	for name, values := range tests {
+		for _, opts := range optionSets {
+			data := encode(t, values, 40, opts)
+			decode(t, data, values, 40, opts)
+			t.Logf("%s %+v: %d values in %d bytes", name, opts, len(values), len(data))
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	// The coded size of a stream of independent bits approaches the entropy as
+	// the model learns the probability.
+	const n = 100000
+	rng := rand.New(rand.NewSource(2))
+	for _, p := range []float64{0.5, 0.1, 0.01} {
+		var buf bytes.Buffer
+		w := bitstream.NewWriter(&buf, nil)
+		e := arith.NewEncoder(w)
+		m := arith.NewAdaptiveBit(7)
+		for range n {
+			if err := e.EncodeBit(m, rng.Float64() < p); err != nil {
+				t.Fatalf("EncodeBit: unexpected error: %v", err)
+			}
+		}
+		e.Close()
+		w.Flush()
+
+		entropy := -p*math.Log2(p) - (1-p)*math.Log2(1-p)
+		got := float64(8*buf.Len()) / n
+		t.Logf("p=%v: %.4f bits per bit, entropy %.4f", p, got, entropy)
+		if got > entropy*1.05+0.001 {
+			t.Errorf("p=%v: coded %.4f bits per bit, entropy is %.4f", p, got, entropy)
+		}
+	}
+}
+
+// skewModel is a fixed Model in which each symbol is twice as likely as the
+// next, demonstrating a caller-supplied model.
+type skewModel int
+
+func (m skewModel) Total() uint32 { return 1<<m - 1 }
+
+func (m skewModel) Interval(sym int) (lo, hi uint32) {
+	if sym < 0 || sym >= int(m) {
+		return 0, 0
+	}
+	hi = 1<<m - 1<<(int(m)-1-sym)
+	return hi - 1<<(int(m)-1-sym), hi
+}
+
+func (m skewModel) Find(v uint32) (sym int, lo, hi uint32) {
+	for sym = 0; sym < int(m); sym++ {
+		if lo, hi = m.Interval(sym); v < hi {
+			break
+		}
+	}
+	return
+}
+
+func (skewModel) Update(int) {}
+
+func TestCustomModel(t *testing.T) {
+	const m = skewModel(12)
+	syms := []int{0, 0, 1, 0, 11, 2, 0, 0, 0, 3, 1, 10, 0}
+
+	var buf bytes.Buffer
+	w := bitstream.NewWriter(&buf, nil)
+	e := arith.NewEncoder(w)
+	for _, sym := range syms {
+		if err := e.Encode(m, sym); err != nil {
+			t.Fatalf("Encode %d: unexpected error: %v", sym, err)
+		}
+	}
+	e.Close()
+	w.Flush()
+
+	d := arith.NewDecoder(bitstream.NewReader(&buf, nil))
+	for i, want := range syms {
+		if got, err := d.Decode(m); err != nil || got != want {
+			t.Errorf("Decode %d: got (%d, %v), want (%d, nil)", i, got, err, want)
+		}
+	}
+}
+
+// fixedBit is a BitModel with a constant probability.
+type fixedBit uint32
+
+func (m fixedBit) P0() uint32 { return uint32(m) }
+func (fixedBit) Update(bool)  {}
+
+func TestErrors(t *testing.T) {
+	w := bitstream.NewWriter(io.Discard, nil)
+	e := arith.NewEncoder(w)
+	for _, p := range []fixedBit{0, 1 << arith.ProbBits} {
+		if err := e.EncodeBit(p, false); !errors.Is(err, arith.ErrModel) {
+			t.Errorf("EncodeBit P0=%d: got %v, want %v", p, err, arith.ErrModel)
+		}
+	}
+	fm := arith.NewFrequencyModel(4, 0, 0)
+	for _, sym := range []int{-1, 4} {
+		if err := e.Encode(fm, sym); !errors.Is(err, arith.ErrModel) {
+			t.Errorf("Encode %d: got %v, want %v", sym, err, arith.ErrModel)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	if err := e.EncodeBit(fixedBit(100), true); !errors.Is(err, arith.ErrClosed) {
+		t.Errorf("EncodeBit after Close: got %v, want %v", err, arith.ErrClosed)
+	}
+
+	// A truncated code reports an unexpected EOF.
+	values := []value{{sym: 3}, {isBit: true, bit: true}, {sym: 1}}
+	data := encode(t, values, 4, nil)
+	d := arith.NewDecoder(bitstream.NewReader(bytes.NewReader(data[:3]), nil))
+	if _, err := d.Decode(arith.NewFrequencyModel(4, 0, 0)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Decode truncated: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,143 @@
+package arith
+
+// ProbBits is the precision of the probabilities reported by a BitModel.
+const ProbBits = 16
+
+// A BitModel is an adaptive model of the probability of a binary decision.
+type BitModel interface {
+	// P0 returns the probability that the next bit is zero, in units of
+	// 2^-ProbBits.  The probability must satisfy 0 < P0 < 1<<ProbBits.
+	P0() uint32
+
+	// Update adapts the model after bit has been coded.
+	Update(bit bool)
+}
+
+// A Model is an adaptive model of the probabilities of the symbols of an
+// alphabet.  Each symbol has a frequency, and the probability of a symbol is
+// its frequency divided by the total of all the frequencies.  The symbols are
+// assigned consecutive intervals of the cumulative frequencies.
+type Model interface {
+	// Total returns the total frequency of all the symbols, which must satisfy
+	// 0 < Total ≤ MaxTotal.
+	Total() uint32
+
+	// Interval returns the interval [lo, hi) of cumulative frequencies
+	// assigned to sym.  If sym cannot be coded, the interval is empty.
+	Interval(sym int) (lo, hi uint32)
+
+	// Find returns the symbol whose interval [lo, hi) contains v, for
+	// 0 ≤ v < Total.
+	Find(v uint32) (sym int, lo, hi uint32)
+
+	// Update adapts the model after sym has been coded.
+	Update(sym int)
+}
+
+// An AdaptiveBit is a BitModel that tracks the probability of a zero as an
+// exponentially weighted average of the bits coded.  Each update moves the
+// probability toward the bit coded by a fraction 2^-shift of the distance.
+// A small shift adapts quickly, while a large shift gives a more stable and
+// more precise estimate.
+type AdaptiveBit struct {
+	p0    uint32
+	shift int
+}
+
+// NewAdaptiveBit returns an AdaptiveBit in which zero and one are initially
+// equally likely, with the given adaptation shift.  It panics if shift is not
+// in the range 1 ≤ shift < ProbBits.
+func NewAdaptiveBit(shift int) *AdaptiveBit {
+	if shift < 1 || shift >= ProbBits {
+		panic("arith: adaptation shift out of range")
+	}
+	return &AdaptiveBit{p0: 1 << (ProbBits - 1), shift: shift}
+}
+
+// P0 implements part of the BitModel interface.
+func (m *AdaptiveBit) P0() uint32 { return m.p0 }
+
+// Update implements part of the BitModel interface.  The probability never
+// reaches 0 or 1, since the adjustment vanishes as the probability approaches
+// either limit.
+func (m *AdaptiveBit) Update(bit bool) {
+	if bit {
+		m.p0 -= m.p0 >> m.shift
+	} else {
+		m.p0 += (1<<ProbBits - m.p0) >> m.shift
+	}
+}
+
+// A FrequencyModel is a Model that counts the occurrences of each symbol.
+// Each time a symbol is coded, its frequency grows by a fixed increment.
+// When the total exceeds a limit, all the frequencies are halved, so that
+// recent symbols have more weight than older ones.
+//
+// Interval and Find take time proportional to the number of symbols, so
+// callers with large alphabets may prefer a Model with a faster search.
+type FrequencyModel struct {
+	freq  []uint32
+	total uint32
+	inc   uint32
+	limit uint32
+}
+
+// NewFrequencyModel returns a FrequencyModel of n symbols, numbered 0 to n-1,
+// which are initially equally likely.  If inc == 0, an increment of 32 is
+// used.  If limit == 0, a limit of 1<<16 is used.  It panics if n < 1, if the
+// limit is less than n or greater than MaxTotal, or if inc exceeds the limit.
+func NewFrequencyModel(n int, inc, limit uint32) *FrequencyModel {
+	if inc == 0 {
+		inc = 32
+	}
+	if limit == 0 {
+		limit = 1 << 16
+	}
+	if n < 1 || uint64(n) > uint64(limit) || limit > MaxTotal || inc > limit {
+		panic("arith: invalid frequency model parameters")
+	}
+	m := &FrequencyModel{freq: make([]uint32, n), inc: inc, limit: limit}
+	for i := range m.freq {
+		m.freq[i] = 1
+	}
+	m.total = uint32(n)
+	return m
+}
+
+// Total implements part of the Model interface.
+func (m *FrequencyModel) Total() uint32 { return m.total }
+
+// Interval implements part of the Model interface.
+func (m *FrequencyModel) Interval(sym int) (lo, hi uint32) {
+	if sym < 0 || sym >= len(m.freq) {
+		return 0, 0
+	}
+	for _, f := range m.freq[:sym] {
+		lo += f
+	}
+	return lo, lo + m.freq[sym]
+}
+
+// Find implements part of the Model interface.
+func (m *FrequencyModel) Find(v uint32) (sym int, lo, hi uint32) {
+	for i, f := range m.freq {
+		if v < lo+f {
+			return i, lo, lo + f
+		}
+		lo += f
+	}
+	return len(m.freq), lo, lo // v is out of range
+}
+
+// Update implements part of the Model interface.
+func (m *FrequencyModel) Update(sym int) {
+	m.freq[sym] += m.inc
+	m.total += m.inc
+	for m.total > m.limit {
+		m.total = 0
+		for i, f := range m.freq {
+			m.freq[i] = (f + 1) / 2 // frequencies remain nonzero
+			m.total += m.freq[i]
+		}
+	}
+}
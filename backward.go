@@ -0,0 +1,194 @@
+package bitstream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// ErrNoSentinel is reported by NewBackwardReader and NewBackwardReaderAt when
+// the final byte of the stream does not contain a sentinel bit.
+var ErrNoSentinel = errors.New("missing sentinel bit")
+
+// A BackwardReader reads a stream of bits from its end toward its start, as
+// required by the FSE and Huffman streams of Zstandard (RFC 8878), and by
+// tANS coders in general.  Such streams are written forward, and then padded
+// with a single 1 bit, the sentinel, followed by zero bits to the next byte
+// boundary.  A Writer with the PadStopBit padding option writes streams of
+// this form.  A BackwardReader begins at the bit before the sentinel.
+//
+// The fields of the stream are read in the reverse of the order in which they
+// were written.  Each field read is the value of the bits immediately before
+// the current position, as a Writer with the same options would have written
+// them.  Thus the options that select the bit order of the stream are the same
+// as for a Writer: Zstandard streams, for example, require both LowBitFirst
+// and FieldLowBitFirst.  The BufferSize option sets the number of bytes read
+// from the source at once.  The other options do not affect a BackwardReader.
+type BackwardReader struct {
+	src  io.ReaderAt
+	opts *Options
+
+	pos int64 // the number of bits before the current position
+
+	// The bytes buf hold the bytes of the source beginning at offset boff,
+	// arranged so that the bits of each are in stream order from the highest
+	// to the lowest order.
+	buf  []byte
+	boff int64
+}
+
+// NewBackwardReader returns a BackwardReader that reads the stream held in
+// data, starting from the bit before the sentinel in the final byte.  It
+// reports an error wrapping ErrNoSentinel if data is empty, or its final byte
+// is zero.
+func NewBackwardReader(data []byte, opts *Options) (*BackwardReader, error) {
+	return NewBackwardReaderAt(bytes.NewReader(data), int64(len(data)), opts)
+}
+
+// NewBackwardReaderAt returns a BackwardReader that reads the stream held in
+// the first size bytes of src, starting from the bit before the sentinel in
+// the final byte.  It reports an error wrapping ErrNoSentinel if size is zero,
+// or the final byte is zero.
+func NewBackwardReaderAt(src io.ReaderAt, size int64, opts *Options) (*BackwardReader, error) {
+	if size <= 0 {
+		return nil, offsetError(0, ErrNoSentinel)
+	}
+	r := &BackwardReader{
+		src:  src,
+		opts: opts,
+		buf:  make([]byte, 0, opts.bufferSize()+8), // room for a 64-bit field
+	}
+	last := size - 1
+	if err := r.load(last, last); err != nil {
+		return nil, offsetError(8*last, err)
+	}
+
+	// The sentinel is the last 1 bit of the final byte in stream order, which
+	// is its lowest-order 1 bit once the bits are in stream order.
+	b := r.buf[last-r.boff]
+	if b == 0 {
+		return nil, offsetError(8*last, ErrNoSentinel)
+	}
+	r.pos = 8*last + 7 - int64(bits.TrailingZeros8(b))
+	return r, nil
+}
+
+// ReadBits reads the (up to) count bits before the current position, and
+// moves the position back over them.  If v != nil, the bits are copied into
+// *v, where they occupy the low-order count bits in the order given by the
+// FieldLowBitFirst option.  In any case, the number of bits read is returned.
+// It is an error if count < 0 or count > 64.
+//
+// If err == nil, n == count.
+// If err == io.EOF, 0 ≤ n < count, and the n bits at the start of the stream
+// occupy the low-order n bits of *v.
+// For any other error, n == 0.
+func (r *BackwardReader) ReadBits(count int, v *uint64) (n int, err error) {
+	n, err = r.PeekBits(count, v)
+	if err == nil || err == io.EOF {
+		r.pos -= int64(n)
+	}
+	return n, err
+}
+
+// ReadBit reads the single bit before the current position, and reports
+// whether it is 1.  If no bits remain, ReadBit returns false, io.EOF.
+func (r *BackwardReader) ReadBit() (bool, error) {
+	var v uint64
+	if n, err := r.ReadBits(1, &v); n == 0 {
+		return false, err
+	}
+	return v != 0, nil
+}
+
+// PeekBits reports the (up to) count bits before the current position,
+// without moving it.  The results of PeekBits follow the same rules as
+// ReadBits, so that a call to PeekBits followed by a call to ReadBits with
+// the same count reports the same bits, unless an error other than io.EOF
+// occurs.
+func (r *BackwardReader) PeekBits(count int, v *uint64) (n int, err error) {
+	if count < 0 || count > 64 {
+		return 0, offsetError(r.pos, ErrCountRange)
+	}
+	if int64(count) > r.pos {
+		count, err = int(r.pos), io.EOF // report a short return
+	}
+	var out uint64
+	if count > 0 {
+		start := r.pos - int64(count)
+		if lerr := r.load(start/8, (r.pos-1)/8); lerr != nil {
+			return 0, offsetError(r.pos, lerr)
+		}
+
+		// Collect the bits of the field from each byte it overlaps, in stream
+		// order.
+		for i := start; i < r.pos; {
+			b := r.buf[i/8-r.boff]
+			skip := i % 8 // bits of b before the field
+			k := min(8-skip, r.pos-i)
+			out = out<<k | uint64(b>>(8-skip-k))&(1<<k-1)
+			i += k
+		}
+	}
+	if v != nil {
+		*v = r.opts.fieldOrder(count, out)
+	}
+	return count, err
+}
+
+// SkipBits moves the current position back over the (up to) count bits
+// before it, and returns the number of bits skipped.  Unlike ReadBits, count
+// may exceed 64.  It is an error if count < 0.
+//
+// If err == nil, n == count.
+// If err == io.EOF, 0 ≤ n < count.
+func (r *BackwardReader) SkipBits(count int) (n int, err error) {
+	if count < 0 {
+		return 0, offsetError(r.pos, ErrCountRange)
+	}
+	if int64(count) > r.pos {
+		count, err = int(r.pos), io.EOF
+	}
+	r.pos -= int64(count)
+	return count, err
+}
+
+// Offset returns the position of r in the stream, as an offset in bits from
+// the start of the stream.  This is also the number of bits that remain to be
+// read.
+func (r *BackwardReader) Offset() int64 { return r.pos }
+
+// Options returns a copy of the options in effect for r.
+func (r *BackwardReader) Options() Options {
+	if r.opts == nil {
+		return Options{}
+	}
+	return *r.opts
+}
+
+// load ensures that buf holds the bytes of the source at offsets lo to hi
+// inclusive.  If it does not, load reads a block of bytes ending at hi, since
+// the reader moves toward the start of the source.
+func (r *BackwardReader) load(lo, hi int64) error {
+	if lo >= r.boff && hi < r.boff+int64(len(r.buf)) {
+		return nil
+	}
+	start := max(0, hi+1-int64(cap(r.buf)))
+	buf := r.buf[:hi+1-start]
+	nr, err := r.src.ReadAt(buf, start)
+	if nr < len(buf) {
+		r.buf = r.buf[:0]
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF // the source is shorter than its size
+		}
+		return err
+	}
+	if r.opts != nil && r.opts.LowBitFirst {
+		for i, b := range buf {
+			buf[i] = bitReverse[b]
+		}
+	}
+	r.buf, r.boff = buf, start
+	return nil
+}
@@ -27,15 +27,28 @@
 //	bw.Flush()
 //	// output.String() == "A"
 //
+// A bitstream.BackwardReader supports reading bits from the end of a stream
+// toward its start, as required by Zstandard and other tANS coders.
+//
 // When a stream is encoded as bytes for I/O, the bits may be packed into bytes
 // either from most to least significant, or vice versa.  This behaviour is
 // controlled by the LowBitFirst field of the Options struct.
+//
+// Independently, the bits of a multi-bit field may be exchanged with the
+// stream starting from the most significant bit of the value, or from the
+// least significant.  This behaviour is controlled by the FieldLowBitFirst
+// field of the Options struct.  Setting both LowBitFirst and FieldLowBitFirst
+// gives the bit order of DEFLATE (RFC 1951), in which the stream is a
+// little-endian integer and each field is a slice of its bits.
 package bitstream
 
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math/bits"
+	"strconv"
 )
 
 // Options control the behaviour of a reader or writer. A nil *Options is
@@ -49,6 +62,138 @@ type Options struct {
 	// example, the bit sequence 0 1 0 0 1 1 0 1 produces a byte with the value
 	// 0x4D.
 	LowBitFirst bool
+
+	// If true, the first bit of a multi-bit field in the stream is the least
+	// significant bit of its value.  For example, reading a 3-bit field from
+	// the bit sequence 1 1 0 gives the value 3.
+	//
+	// If false, the first bit of a field is the most significant bit of its
+	// value, so reading a 3-bit field from the sequence 1 1 0 gives 6.
+	//
+	// This affects fields read and written by ReadBits, PeekBits, WriteBits,
+	// and the methods built on them, including the bytes exchanged by Read and
+	// Write.  It does not affect variable-length codes such as ReadUnary and
+	// ReadExpGolomb, whose bits are always in stream order.
+	FieldLowBitFirst bool
+
+	// The policy used to fill out a partial byte when a Writer is flushed, and
+	// to verify padding when a Reader is aligned.  The zero value is PadZeros.
+	// NewReader, NewWriter, and the Reset methods panic if this is not one of
+	// the defined modes.
+	Padding PadMode
+
+	// The byte whose trailing bits are used as padding by the PadPattern mode,
+	// so that the final partial byte of the stream is completed by the bits of
+	// PadBits at the same positions.  It is ignored by the other modes.
+	PadBits byte
+
+	// If true, a Reader reads only as many bytes from its source as are needed
+	// to satisfy each request, rather than reading ahead in blocks of 8 bytes.
+	// This is useful for interactive sources such as pipes and sockets, where
+	// reading ahead may block.  If the source implements io.ByteReader, it is
+	// used to read one byte at a time.  This option overrides BufferSize for
+	// a Reader.
+	NoReadAhead bool
+
+	// The number of bytes a Reader requests from its source at once, or that a
+	// Writer accumulates before writing to its destination.  Values less than
+	// 8 are treated as 8, and a Writer rounds the size up to a multiple of 8.
+	// Larger buffers reduce the number of calls to the underlying reader or
+	// writer, which is useful when it is unbuffered.
+	BufferSize int
+
+	// If true, a Writer reports an error when asked to write a value that has
+	// bits set above the width of the field.  Otherwise, those bits are
+	// silently discarded.
+	Strict bool
+}
+
+// A PadMode specifies how to fill the bits between the end of the data and the
+// next byte boundary.
+type PadMode int
+
+const (
+	// PadZeros pads with zero bits.
+	PadZeros PadMode = iota
+
+	// PadOnes pads with one bits, as in JPEG entropy-coded segments.
+	PadOnes
+
+	// PadStopBit pads with a single one bit followed by zero bits, as in the
+	// H.264 rbsp_trailing_bits syntax.  The stop bit is always present, so if
+	// the stream is already at a byte boundary, a whole byte is added.  A
+	// Writer adds no stop bit when flushed with no bits written since the last
+	// Flush.
+	PadStopBit
+
+	// PadPattern pads with the trailing bits of the PadBits option.
+	PadPattern
+)
+
+// String returns the name of the padding mode.
+func (m PadMode) String() string {
+	switch m {
+	case PadZeros:
+		return "PadZeros"
+	case PadOnes:
+		return "PadOnes"
+	case PadStopBit:
+		return "PadStopBit"
+	case PadPattern:
+		return "PadPattern"
+	default:
+		return "PadMode(" + strconv.Itoa(int(m)) + ")"
+	}
+}
+
+// valid reports whether m is one of the defined padding modes.
+func (m PadMode) valid() bool { return m >= PadZeros && m <= PadPattern }
+
+// checkPadding panics if o specifies an undefined padding mode.
+func (o *Options) checkPadding() {
+	if o != nil && !o.Padding.valid() {
+		panic(fmt.Sprintf("bitstream: invalid padding mode %v", o.Padding))
+	}
+}
+
+// padding returns the count and values of the padding bits required to reach
+// the next byte boundary when n bits remain before it.
+func (o *Options) padding(n int) (int, uint64) {
+	if o == nil {
+		return n, 0
+	}
+	switch o.Padding {
+	case PadOnes:
+		return n, 1<<n - 1
+	case PadStopBit:
+		if n == 0 {
+			n = 8
+		}
+		return n, 1 << (n - 1)
+	case PadPattern:
+		return n, uint64(o.PadBits) & (1<<n - 1)
+	}
+	return n, 0
+}
+
+func (o *Options) noReadAhead() bool { return o != nil && o.NoReadAhead }
+
+func (o *Options) fieldLowBitFirst() bool { return o != nil && o.FieldLowBitFirst }
+
+// fieldOrder converts the low-order count bits of v between stream order and
+// field order.  The conversion is its own inverse.
+func (o *Options) fieldOrder(count int, v uint64) uint64 {
+	if o.fieldLowBitFirst() {
+		return bits.Reverse64(v) >> (64 - count)
+	}
+	return v
+}
+
+func (o *Options) bufferSize() int {
+	if o == nil || o.BufferSize < 8 {
+		return 8
+	}
+	return (o.BufferSize + 7) &^ 7
 }
 
 func (o *Options) flipBits(data []byte) []byte {
@@ -73,22 +218,68 @@ type Reader struct {
 	// to the reader.  Any bits with index ≥ nb are garbage.
 	buf uint64
 	nb  uint8 // 0 ≤ nb ≤ 64
+
+	// The low-order nn bits of next hold data read from r to satisfy a
+	// lookahead, which have not yet been moved into buf.  When nn > 0, these
+	// bits logically follow the nb bits of buf in the stream.
+	next uint64
+	nn   uint8 // 0 ≤ nn ≤ 64, always a multiple of 8
+
+	// Bytes data[pos:] have been read from r but not yet moved into the
+	// lookahead.  These bytes are stored as read, without bit reversal.
+	data []byte
+	pos  int
+
+	off int64 // number of bits delivered to the reader
 }
 
 // ErrCountRange is returned when a bit count is < 0 or > 64.
 var ErrCountRange = errors.New("count is out of range")
 
+// An OffsetError reports an error along with the offset in the stream, in
+// bits, at which it occurred.  Apart from io.EOF, which is returned directly,
+// errors returned by the methods of a Reader or Writer have this type.
+type OffsetError struct {
+	Offset int64 // bit offset where the error occurred
+	Err    error // the underlying error
+}
+
+// Error satisfies the error interface.
+func (e *OffsetError) Error() string { return fmt.Sprintf("at bit %d: %v", e.Offset, e.Err) }
+
+// Unwrap returns the underlying error.
+func (e *OffsetError) Unwrap() error { return e.Err }
+
+// offsetError wraps err in an *OffsetError at offset off.  As a special case,
+// nil and io.EOF are returned unmodified.
+func offsetError(off int64, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return &OffsetError{Offset: off, Err: err}
+}
+
 // ReadBits reads the next (up to) count bits from the reader.  If v != nil,
-// the bits are copied into *v, where they occupy the low-order count bits.  In
-// any case, the number of bits read is returned.  It is an error if count < 0
-// or count > 64.
+// the bits are copied into *v, where they occupy the low-order count bits in
+// the order given by the FieldLowBitFirst option.  In any case, the number of
+// bits read is returned.  It is an error if count < 0 or count > 64.
 //
 // If err == nil, n == count.
-// If err == io.EOF, 0 ≤ n < count.
+// If err == io.EOF, 0 ≤ n < count, and the bits read occupy the low-order n
+// bits of *v.
 // For any other error, n == 0.
 func (r *Reader) ReadBits(count int, v *uint64) (n int, err error) {
+	n, err = r.readBits(count, v)
+	if v != nil && n > 0 {
+		*v = r.opts.fieldOrder(n, *v)
+	}
+	return n, err
+}
+
+// readBits implements ReadBits, delivering the bits in stream order.
+func (r *Reader) readBits(count int, v *uint64) (n int, err error) {
 	if count < 0 || count > 64 {
-		return 0, ErrCountRange
+		return 0, offsetError(r.off, ErrCountRange)
 	}
 	ucount := uint8(count)
 
@@ -99,51 +290,281 @@ func (r *Reader) ReadBits(count int, v *uint64) (n int, err error) {
 			*v = out >> (r.nb - ucount)
 		}
 		r.nb -= ucount
+		r.off += int64(count)
 		return count, nil
 	}
 
 	nbits := r.nb // how many bits we have copied out
 
-	// Read in 8 more bytes to refill r.buf.  If this fails for any reason
-	// except reaching EOF, we return the error without consuming anything.
-	//
-	// To simplify decoding, the buffer is pre-padded with zeroes.  On a short
-	// read, we use the padding to zero-fill the slice passed to the decoder.
+	// Refill r.buf from the lookahead, reading more if necessary.  If this
+	// fails for any reason except reaching EOF, we return the error without
+	// consuming anything.
+	if err := r.fill(ucount - nbits); err != nil {
+		return 0, offsetError(r.off, err)
+	}
+	r.buf, r.nb, r.nn = r.next, r.nn, 0
 
-	buf := make([]byte, 16) // |...8 zeroes...|...8 buffer bytes...|
-	nr, err := io.ReadFull(r.r, buf[8:])
-	switch err {
-	case nil, io.EOF, io.ErrUnexpectedEOF:
-		// Despite the name, ErrUnexpectedEOF is not unexpected here; it just
-		// means we got a short read.  We'll treat that as EOF if we wind up
-		// having to short the caller.
-		err = nil
+	nleft := ucount - nbits // how many bits we still need to copy
+	if nleft > r.nb {
+		nleft = r.nb
+		err = io.EOF // report a short return
+	}
+	out = (out << nleft) | (r.buf&((1<<r.nb)-1))>>(r.nb-nleft)
+	r.nb -= nleft
+	nbits += nleft
+	r.off += int64(nbits)
+
+	if v != nil {
+		*v = out
+	}
+	return int(nbits), err
+}
 
-		r.buf = binary.BigEndian.Uint64(r.opts.flipBits(buf[nr:]))
-		r.nb = 8 * uint8(nr)
+// Offset returns the number of bits that have been consumed from r by reading
+// or skipping.
+func (r *Reader) Offset() int64 { return r.off }
 
-		nleft := ucount - nbits // how many bits we still need to copy
-		if nleft > r.nb {
-			nleft = r.nb
-			err = io.EOF // report a short return
+// ReadBit reads the next single bit from the reader, and reports whether it is
+// 1.  If no bits remain, ReadBit returns false, io.EOF.
+func (r *Reader) ReadBit() (bool, error) {
+	if r.nb != 0 {
+		r.nb--
+		r.off++
+		return r.buf>>r.nb&1 != 0, nil
+	}
+	var v uint64
+	if n, err := r.ReadBits(1, &v); n == 0 {
+		return false, err
+	}
+	return v != 0, nil
+}
+
+// PeekBits reports the next (up to) count bits from the reader, without
+// consuming them.  If v != nil, the bits are copied into *v, where they occupy
+// the low-order count bits.  In any case, the number of bits available is
+// returned.  It is an error if count < 0 or count > 64.
+//
+// The results of PeekBits follow the same rules as ReadBits, so that a call to
+// PeekBits followed by a call to ReadBits with the same count reports the same
+// bits, unless an error other than io.EOF occurs.
+func (r *Reader) PeekBits(count int, v *uint64) (n int, err error) {
+	n, err = r.peekBits(count, v)
+	if v != nil && n > 0 {
+		*v = r.opts.fieldOrder(n, *v)
+	}
+	return n, err
+}
+
+// peekBits implements PeekBits, delivering the bits in stream order.
+func (r *Reader) peekBits(count int, v *uint64) (n int, err error) {
+	if count < 0 || count > 64 {
+		return 0, offsetError(r.off, ErrCountRange)
+	}
+	ucount := uint8(count)
+
+	out := r.buf & ((1 << r.nb) - 1)
+	if ucount <= r.nb {
+		// We have enough already buffered to satisfy this request.
+		if v != nil {
+			*v = out >> (r.nb - ucount)
 		}
+		return count, nil
+	}
 
-		out = (out << nleft) | (r.buf >> (r.nb - nleft))
-		r.nb -= nleft
-		nbits += nleft
+	// Make sure the lookahead is populated.  Because r.nb < count ≤ 64 and the
+	// lookahead holds up to 64 bits, this is always sufficient unless the
+	// input is exhausted.
+	if err := r.fill(ucount - r.nb); err != nil {
+		return 0, offsetError(r.off, err)
+	}
 
-	default:
-		return 0, err
+	nleft := ucount - r.nb // how many bits we need from the lookahead
+	if nleft > r.nn {
+		nleft = r.nn
+		err = io.EOF // report a short return
 	}
+	out = (out << nleft) | (r.next&((1<<r.nn)-1))>>(r.nn-nleft)
 
 	if v != nil {
 		*v = out
 	}
-	return int(nbits), err
+	return int(r.nb + nleft), err
+}
+
+// SkipBits discards the next (up to) count bits from the reader, and returns
+// the number of bits discarded.  Unlike ReadBits, count may exceed 64; whole
+// bytes not already buffered are skipped directly on the underlying reader.
+// It is an error if count < 0.
+//
+// If err == nil, n == count.
+// If err == io.EOF, 0 ≤ n < count.
+// For any other error, n reports how many bits were discarded before the
+// error occurred.
+func (r *Reader) SkipBits(count int) (n int, err error) {
+	if count < 0 {
+		return 0, offsetError(r.off, ErrCountRange)
+	}
+
+	// Discard buffered bits first, including any lookahead.
+	for n < count && (r.nb > 0 || r.nn > 0) {
+		if r.nb == 0 {
+			r.buf, r.nb, r.nn = r.next, r.nn, 0
+		}
+		k := uint8(min(count-n, int(r.nb)))
+		r.nb -= k
+		r.off += int64(k)
+		n += int(k)
+	}
+
+	// Skip whole bytes without decoding them, first from the buffer and then
+	// from the underlying reader.
+	if nbytes := min((count-n)/8, len(r.data)-r.pos); nbytes > 0 {
+		r.pos += nbytes
+		r.off += 8 * int64(nbytes)
+		n += 8 * nbytes
+	}
+	if nbytes := (count - n) / 8; nbytes > 0 {
+		ns, err := io.CopyN(io.Discard, r.r, int64(nbytes))
+		r.off += 8 * ns
+		n += 8 * int(ns)
+		if err != nil {
+			return n, offsetError(r.off, err)
+		}
+	}
+
+	// Whatever remains is less than a byte.
+	nr, err := r.ReadBits(count-n, nil)
+	return n + nr, err
+}
+
+// Padding returns the number 0 ≤ n < 8 of additional bits that would have to
+// be read from r to reach the next byte boundary in the stream.
+func (r *Reader) Padding() int { return int(r.nb % 8) }
+
+// Align discards the padding bits before the next byte boundary in the
+// stream, and returns the number of bits discarded.  The number of padding
+// bits is determined by the Padding option; with the default policy, if r is
+// already at a byte boundary, Align does nothing.
+//
+// If verify is true and the discarded bits do not match those specified by the
+// Padding option, Align returns an error wrapping a *PaddingError.  The bits
+// are discarded regardless.
+func (r *Reader) Align(verify bool) (int, error) {
+	count, want := r.opts.padding(r.Padding())
+	var got uint64
+	nr, err := r.readBits(count, &got)
+	if err != nil {
+		return nr, err
+	}
+	if verify && got != want {
+		return nr, offsetError(r.off-int64(nr), &PaddingError{Count: count, Got: got, Want: want})
+	}
+	return nr, nil
+}
+
+// A PaddingError is reported by Reader.Align when the bits skipped to reach a
+// byte boundary do not have the expected values.
+type PaddingError struct {
+	Count int    // the number of padding bits
+	Got   uint64 // the padding bits read from the stream
+	Want  uint64 // the expected padding bits
+}
+
+// Error satisfies the error interface.
+func (e *PaddingError) Error() string {
+	return fmt.Sprintf("invalid padding: got %0*b, want %0*b", e.Count, e.Got, e.Count, e.Want)
+}
+
+// fill ensures the lookahead holds at least need bits, reading more bytes
+// from the underlying reader if it does not.  Unless the NoReadAhead option is
+// set, fill reads enough to fill the lookahead completely, and reads as much
+// as the buffer will hold from the underlying reader.  On reaching EOF, fill
+// returns nil and the lookahead may be short or empty.
+//
+// Any bytes successfully read are retained even if an error occurs, so that a
+// failed read does not lose data.
+func (r *Reader) fill(need uint8) error {
+	if r.nn >= need {
+		return nil
+	}
+	want := 8 - int(r.nn)/8 // the number of bytes to move into the lookahead
+	if r.opts.noReadAhead() {
+		want = int(need-r.nn+7) / 8
+	}
+
+	var err error
+	if avail := len(r.data) - r.pos; avail < want {
+		// Shift the unread bytes to the front of the buffer, and read more.
+		nc := copy(r.data[:cap(r.data)], r.data[r.pos:])
+		r.data, r.pos = r.data[:nc], 0
+
+		var nr int
+		if br, ok := r.r.(io.ByteReader); ok && r.opts.noReadAhead() {
+			for nc+nr < want {
+				var b byte
+				b, err = br.ReadByte()
+				if err != nil {
+					break
+				}
+				r.data = append(r.data, b)
+				nr++
+			}
+		} else if r.opts.noReadAhead() {
+			nr, err = io.ReadFull(r.r, r.data[nc:want])
+			r.data = r.data[:nc+nr]
+		} else {
+			nr, err = io.ReadAtLeast(r.r, r.data[nc:cap(r.data)], want-nc)
+			r.data = r.data[:nc+nr]
+		}
+	}
+
+	next := r.data[r.pos:min(r.pos+want, len(r.data))]
+	for _, b := range next {
+		if r.opts != nil && r.opts.LowBitFirst {
+			b = bitReverse[b]
+		}
+		r.next = r.next<<8 | uint64(b)
+	}
+	r.nn += 8 * uint8(len(next))
+	r.pos += len(next)
+
+	switch err {
+	case nil, io.EOF, io.ErrUnexpectedEOF:
+		// Despite the name, ErrUnexpectedEOF is not unexpected here; it just
+		// means we got a short read.  The caller will treat that as EOF if it
+		// winds up having to short its own caller.
+		return nil
+	default:
+		return err
+	}
 }
 
 // NewReader returns a bitstream reader that consumes data from r.
-func NewReader(r io.Reader, opts *Options) *Reader { return &Reader{r: r, opts: opts} }
+func NewReader(r io.Reader, opts *Options) *Reader {
+	br := new(Reader)
+	br.Reset(r, opts)
+	return br
+}
+
+// Reset discards all state held by r, including any buffered data, and
+// prepares it to read from src with the given options, as if it had been
+// newly created by NewReader.  Reset reuses existing buffers where possible.
+func (r *Reader) Reset(src io.Reader, opts *Options) {
+	opts.checkPadding()
+	data := r.data[:0]
+	if cap(data) != opts.bufferSize() {
+		data = make([]byte, 0, opts.bufferSize())
+	}
+	*r = Reader{r: src, opts: opts, data: data}
+}
+
+// Options returns a copy of the options in effect for r.
+func (r *Reader) Options() Options {
+	if r.opts == nil {
+		return Options{}
+	}
+	return *r.opts
+}
 
 // A Writer supports writing groups of 0 to 64 bits to an underlying io.Writer.
 // Writes are buffered, so the caller must call Flush when finished to ensure
@@ -157,14 +578,27 @@ type Writer struct {
 
 	// The low-order nb bits of buf hold the bits that have been received by
 	// calls to Write but not yet delivered to w.  We maintain the invariant
-	// that buf always has < 64 bits; when it reaches 64 we write immediately.
+	// that buf always has < 64 bits; when it reaches 64 we move it to data.
 	// Any bits with index ≥ nb are garbage.
 	buf uint64
 	nb  uint8 // 0 ≤ nb < 64
+
+	// Bytes of data are complete words that have not yet been written to w,
+	// already in output order.  When len(data) reaches size, we write
+	// immediately.  The capacity of data exceeds size to leave room for the
+	// tail of the stream when flushing.
+	data []byte
+	size int
+
+	off     int64 // number of bits moved out of buf
+	flushed int64 // the offset at the end of the last Flush
 }
 
-// WriteBits appends the low-order count bits of v to the stream, and returns
-// the number of bits written.  It is an error if count < 0 or count > 64.
+// WriteBits appends the low-order count bits of v to the stream, in the order
+// given by the FieldLowBitFirst option, and returns the number of bits
+// written.  It is an error if count < 0 or count > 64.  Any bits of v above
+// count are ignored, unless the Strict option is set, in which case WriteBits
+// reports an error wrapping a *RangeError and writes nothing.
 //
 // Any other error is the result of a call to the underlying io.Writer.  When
 // that occurs, the write is abandoned and no bits are added to the stream.
@@ -172,8 +606,20 @@ type Writer struct {
 // the failed io.Writer, but it is effectively 0 for the bitstream.
 func (w *Writer) WriteBits(count int, v uint64) (int, error) {
 	if count < 0 || count > 64 {
-		return 0, ErrCountRange
+		return 0, offsetError(w.Offset(), ErrCountRange)
+	}
+	if v>>count != 0 {
+		if w.opts != nil && w.opts.Strict {
+			return 0, offsetError(w.Offset(), &RangeError{Count: count, Value: v})
+		}
+		v &= 1<<count - 1
 	}
+	return w.writeBits(count, w.opts.fieldOrder(count, v))
+}
+
+// writeBits implements WriteBits for bits in stream order.  The caller must
+// ensure that 0 ≤ count ≤ 64 and v has no bits set above count.
+func (w *Writer) writeBits(count int, v uint64) (int, error) {
 	ucount := uint8(count)
 
 	// Shift in as much of the input as possible.  There is always at least one
@@ -186,15 +632,21 @@ func (w *Writer) WriteBits(count int, v uint64) (int, error) {
 	out := w.buf<<n2copy | v>>nleft
 	nused := w.nb + n2copy // how many bits of out are in-use
 
-	// If the buffer is full, send it to the underlying writer.  If that
-	// succeeds, we definitely have room for any remaining bits.
+	// If the buffer is full, move it to the output buffer, and if that is full
+	// send it to the underlying writer.  If that succeeds, we definitely have
+	// room for any remaining bits.
 	if nused == 64 {
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, out)
-		nw, err := w.w.Write(w.opts.flipBits(buf))
-		if err != nil {
-			return nw, err // write failed; don't update anything
+		end := len(w.data) + 8
+		binary.BigEndian.PutUint64(w.data[len(w.data):end], out)
+		w.opts.flipBits(w.data[len(w.data):end])
+		if end < w.size {
+			w.data = w.data[:end]
+		} else if nw, err := w.w.Write(w.data[:end]); err != nil {
+			return nw, offsetError(w.Offset(), err) // write failed; don't update anything
+		} else {
+			w.data = w.data[:0]
 		}
+		w.off += 64
 		out = v
 		nused = nleft
 	}
@@ -204,6 +656,23 @@ func (w *Writer) WriteBits(count int, v uint64) (int, error) {
 	return count, nil
 }
 
+// WriteBit appends a single bit to the stream, 1 if bit is true, otherwise 0.
+// Any error is the result of a call to the underlying io.Writer, as described
+// for WriteBits.
+func (w *Writer) WriteBit(bit bool) error {
+	var v uint64
+	if bit {
+		v = 1
+	}
+	if w.nb < 63 {
+		w.buf = w.buf<<1 | v
+		w.nb++
+		return nil
+	}
+	_, err := w.WriteBits(1, v)
+	return err
+}
+
 // Padding returns the number 0 ≤ n < 8 of additional bits that would have to
 // be written to w to ensure that the output is an even number of 8-bit bytes.
 func (w *Writer) Padding() int {
@@ -213,28 +682,109 @@ func (w *Writer) Padding() int {
 	return 0
 }
 
+// Align pads the stream with copies of the fill bit to the next byte
+// boundary, and returns the number of bits added.  If w is already at a byte
+// boundary, Align does nothing.  Unlike Flush, Align does not force buffered
+// data to be written to the underlying writer.
+func (w *Writer) Align(fill bool) (int, error) { return w.AlignTo(8, fill) }
+
+// AlignTo pads the stream with copies of the fill bit until its offset is a
+// multiple of n bits, and returns the number of bits added.  It is an error if
+// n ≤ 0.  Like Align, AlignTo does not force buffered data to be written.
+//
+// If an error occurs while writing the padding, the returned count reports
+// how many padding bits were added before the failure.
+func (w *Writer) AlignTo(n int, fill bool) (int, error) {
+	if n <= 0 {
+		return 0, offsetError(w.Offset(), ErrCountRange)
+	}
+	var bits uint64
+	if fill {
+		bits = ^bits
+	}
+	npad := int((int64(n) - w.Offset()%int64(n)) % int64(n))
+	for nw := 0; nw < npad; {
+		k := min(npad-nw, 64)
+		if _, err := w.writeBits(k, bits>>(64-k)); err != nil {
+			return nw, err
+		}
+		nw += k
+	}
+	return npad, nil
+}
+
 // Flush writes any unwritten data remaining in w to the underlying writer.  If
 // the data remaining do not comprise a round number of bytes, they are padded
-// with zeroes to the next byte boundary.
+// to the next byte boundary as specified by the Padding option.  Padding is
+// added only if bits have been written since the last Flush, so that flushing
+// repeatedly does not alter the stream.  If Flush fails, no padding is added
+// to the stream.
 func (w *Writer) Flush() error {
-	if w.nb != 0 {
-		out := w.buf << uint(w.Padding())
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, out)
-
-		// When flushing, the buffer may not be full; so skip any leading bytes
-		// that are not part of the padded output.
-		skip := 8 - (w.nb+7)/8
-		if _, err := w.w.Write(w.opts.flipBits(buf[skip:])); err != nil {
-			return err
-		}
-		w.nb = 0
+	var count int
+	var pad uint64
+	if w.Offset() != w.flushed {
+		count, pad = w.opts.padding(w.Padding())
 	}
+	total := w.nb + uint8(count)
+	if total == 0 && len(w.data) == 0 {
+		return nil
+	}
+
+	// The buffered bits plus padding may exceed 64 bits, so assemble them as a
+	// 128-bit value with the first bit of the stream in the high-order bit.
+	padHi := pad << (64 - count)
+	hi := w.buf<<(64-w.nb) | padHi>>w.nb
+	lo := padHi << (64 - w.nb)
+
+	// Append the tail to the output buffer, but do not commit it until the
+	// write succeeds.
+	tail := w.data[len(w.data) : len(w.data)+16]
+	binary.BigEndian.PutUint64(tail[:8], hi)
+	binary.BigEndian.PutUint64(tail[8:], lo)
+	w.opts.flipBits(tail[:total/8])
+	if _, err := w.w.Write(w.data[:len(w.data)+int(total/8)]); err != nil {
+		return offsetError(w.Offset(), err)
+	}
+	w.data = w.data[:0]
+	w.off += int64(total)
+	w.nb = 0
+	w.flushed = w.off
 	return nil
 }
 
+// Offset returns the number of bits that have been written to w, including
+// any that are buffered but not yet delivered to the underlying writer, and
+// any padding added by Flush.
+func (w *Writer) Offset() int64 { return w.off + int64(w.nb) }
+
 // NewWriter returns a bitstream writer that delivers output to w.
-func NewWriter(w io.Writer, opts *Options) *Writer { return &Writer{w: w, opts: opts} }
+func NewWriter(w io.Writer, opts *Options) *Writer {
+	bw := new(Writer)
+	bw.Reset(w, opts)
+	return bw
+}
+
+// Reset discards all state held by w, including any buffered data that have
+// not been flushed, and prepares it to write to dst with the given options, as
+// if it had been newly created by NewWriter.  Reset reuses existing buffers
+// where possible.
+func (w *Writer) Reset(dst io.Writer, opts *Options) {
+	opts.checkPadding()
+	size := opts.bufferSize()
+	data := w.data[:0]
+	if cap(data) != size+16 {
+		data = make([]byte, 0, size+16)
+	}
+	*w = Writer{w: dst, opts: opts, data: data, size: size}
+}
+
+// Options returns a copy of the options in effect for w.
+func (w *Writer) Options() Options {
+	if w.opts == nil {
+		return Options{}
+	}
+	return *w.opts
+}
 
 // bitReverse maps each byte value to its bit reversal.
 var bitReverse = [...]byte{
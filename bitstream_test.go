@@ -2,11 +2,19 @@ package bitstream
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"math/bits"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/creachadair/bitstream/internal/bitutil"
 )
 
 // A bit stream for testing, constructed by concatenating the binary encodings
@@ -33,6 +41,13 @@ func flipped(s string) string {
 	return string(o.flipBits([]byte(s)))
 }
 
+func flippedIf(s string, opt *Options) string {
+	if opt != nil && opt.LowBitFirst {
+		return flipped(s)
+	}
+	return s
+}
+
 func TestReader(t *testing.T) {
 	rmsb := NewReader(strings.NewReader(msbTestStream), &Options{LowBitFirst: false})
 	rlsb := NewReader(strings.NewReader(lsbTestStream), &Options{LowBitFirst: true})
@@ -109,10 +124,263 @@ func TestReaderErrors(t *testing.T) {
 
 	// An error other than io.EOF does not consume any data.
 	// This test mucks with the internals to simulate a failure.
+	var oe *OffsetError
 	if nr, err := r.ReadBits(4, &got); err == nil {
 		t.Errorf("Read(4, &v): got nr=%d, value=%d; wanted error", nr, got)
-	} else if err.Error() != "bogus" {
+	} else if !errors.As(err, &oe) || oe.Err.Error() != "bogus" {
 		t.Errorf("Read(4, &v): unexpected error %v", err)
+	} else if oe.Offset != 32 {
+		t.Errorf("Read(4, &v): error offset is %d, want %d", oe.Offset, 32)
+	}
+	if got := r.Offset(); got != 32 {
+		t.Errorf("Offset: got %d, want %d", got, 32)
+	}
+}
+
+func TestPeekBits(t *testing.T) {
+	// Peek windows of various sizes at each position in the test stream, and
+	// check that they agree with what ReadBits subsequently reports.
+	const nbits = 8 * len(msbTestStream)
+	for _, opt := range []*Options{nil, {LowBitFirst: true}} {
+		input := msbTestStream
+		if opt != nil {
+			input = lsbTestStream
+		}
+		for skip := 0; skip <= nbits; skip++ {
+			for _, want := range []int{0, 1, 7, 8, 13, 33, 56, 64} {
+				r := NewReader(strings.NewReader(input), opt)
+				if _, err := r.ReadBits(skip, nil); err != nil {
+					t.Fatalf("ReadBits(%d): unexpected error: %v", skip, err)
+				}
+
+				var peek, read uint64
+				np, perr := r.PeekBits(want, &peek)
+				nr, rerr := r.ReadBits(want, &read)
+				if np != nr || perr != rerr || peek != read {
+					t.Errorf("At %d: PeekBits(%d) = %d, %x, %v; ReadBits = %d, %x, %v",
+						skip, want, np, peek, perr, nr, read, rerr)
+				}
+				if wantN := min(want, nbits-skip); nr != wantN {
+					t.Errorf("At %d: ReadBits(%d) read %d bits, want %d", skip, want, nr, wantN)
+				}
+			}
+		}
+	}
+}
+
+func TestPeekRefill(t *testing.T) {
+	// Peeking across the refill boundary must not lose or reorder data.
+	r := NewReader(strings.NewReader(
+		"\x01\x23\x45\x67\x89\xab\xcd\xef\xfe\xdc\xba\x98\x76\x54\x32\x10"), nil)
+
+	var v uint64
+	if _, err := r.ReadBits(60, &v); err != nil {
+		t.Fatalf("ReadBits(60): unexpected error: %v", err)
+	}
+	if nr, err := r.PeekBits(64, &v); err != nil || nr != 64 || v != 0xffedcba987654321 {
+		t.Errorf("PeekBits(64): got %d, %x, %v; want 64, ffedcba987654321, nil", nr, v, err)
+	}
+	if _, err := r.ReadBits(4, &v); err != nil || v != 0xf {
+		t.Errorf("ReadBits(4): got %x, %v; want f, nil", v, err)
+	}
+	if nr, err := r.PeekBits(64, &v); err != nil || nr != 64 || v != 0xfedcba9876543210 {
+		t.Errorf("PeekBits(64): got %d, %x, %v; want 64, fedcba9876543210, nil", nr, v, err)
+	}
+	if _, err := r.ReadBits(40, &v); err != nil || v != 0xfedcba9876 {
+		t.Errorf("ReadBits(40): got %x, %v; want fedcba9876, nil", v, err)
+	}
+	if nr, err := r.PeekBits(64, &v); err != io.EOF || nr != 24 || v != 0x543210 {
+		t.Errorf("PeekBits(64): got %d, %x, %v; want 24, 543210, EOF", nr, v, err)
+	}
+}
+
+func TestSkipBits(t *testing.T) {
+	const input = "0123456789abcdefghijklmnopqrstuvwxyz"
+	for _, opt := range []*Options{nil, {LowBitFirst: true}} {
+		for _, peek := range []int{0, 5, 64} {
+			for skip := 0; skip < 8*len(input); skip += 3 {
+				r := NewReader(strings.NewReader(flippedIf(input, opt)), opt)
+				if _, err := r.PeekBits(peek, nil); err != nil {
+					t.Fatalf("PeekBits(%d): unexpected error: %v", peek, err)
+				}
+				ns, err := r.SkipBits(skip)
+				if err != nil || ns != skip {
+					t.Errorf("SkipBits(%d): got %d, %v; want %d, nil", skip, ns, err, skip)
+					continue
+				}
+
+				// Check that the next 8 bits are what we expect.
+				var got uint64
+				nr, err := r.ReadBits(8, &got)
+				want := uint64(0)
+				for i := 0; i < nr; i++ {
+					pos := skip + i
+					bit := uint64(input[pos/8]>>(7-pos%8)) & 1
+					want = want<<1 | bit
+				}
+				if got != want {
+					t.Errorf("After SkipBits(%d): got %08b, want %08b (err=%v)", skip, got, want, err)
+				}
+			}
+		}
+	}
+
+	// Skipping past the end reports EOF and the number of bits skipped.
+	r := NewReader(strings.NewReader(input), nil)
+	if ns, err := r.SkipBits(1000); err != io.EOF || ns != 8*len(input) {
+		t.Errorf("SkipBits(1000): got %d, %v; want %d, EOF", ns, err, 8*len(input))
+	}
+	if _, err := r.SkipBits(-1); err == nil {
+		t.Error("SkipBits(-1): got nil, want error")
+	}
+}
+
+func TestReaderAlign(t *testing.T) {
+	//                               1010 1100  1111 1100  1111 1111
+	r := NewReader(strings.NewReader("\xac\xfc\xff"), nil)
+
+	if got := r.Padding(); got != 0 {
+		t.Errorf("Padding at start: got %d, want 0", got)
+	}
+	if n, err := r.Align(true); err != nil || n != 0 {
+		t.Errorf("Align at start: got %d, %v; want 0, nil", n, err)
+	}
+
+	var v uint64
+	r.ReadBits(4, &v)
+	if got := r.Padding(); got != 4 {
+		t.Errorf("Padding after 4 bits: got %d, want 4", got)
+	}
+
+	// The remaining bits of the first byte are nonzero.
+	var pe *PaddingError
+	if n, err := r.Align(true); !errors.As(err, &pe) {
+		t.Errorf("Align(true): got %d, %v; want *PaddingError", n, err)
+	} else if pe.Count != 4 || pe.Got != 0xc || pe.Want != 0 {
+		t.Errorf("Align(true): got error %+v, want count 4, got 1100", pe)
+	}
+	if got := r.Offset(); got != 8 {
+		t.Errorf("Offset after Align: got %d, want 8", got)
+	}
+
+	// The remaining bits of the second byte are zero.
+	r.ReadBits(6, &v)
+	if n, err := r.Align(true); err != nil || n != 2 {
+		t.Errorf("Align(true): got %d, %v; want 2, nil", n, err)
+	}
+
+	// Without verification, nonzero bits are simply discarded.
+	r.ReadBits(1, &v)
+	if n, err := r.Align(false); err != nil || n != 7 {
+		t.Errorf("Align(false): got %d, %v; want 7, nil", n, err)
+	}
+	if n, err := r.ReadBits(1, &v); err != io.EOF || n != 0 {
+		t.Errorf("ReadBits at end: got %d, %v; want 0, EOF", n, err)
+	}
+}
+
+// countReader is an io.Reader that records how many bytes have been read from
+// it.  A countByteReader also implements io.ByteReader.
+type countReader struct {
+	r     *strings.Reader
+	nread int
+}
+
+func (c *countReader) Read(data []byte) (int, error) {
+	nr, err := c.r.Read(data)
+	c.nread += nr
+	return nr, err
+}
+
+type countByteReader struct{ countReader }
+
+func (c *countByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.nread++
+	}
+	return b, err
+}
+
+func TestNoReadAhead(t *testing.T) {
+	const input = "0123456789abcdefghijklmnopqrstuvwxyz"
+	opt := &Options{NoReadAhead: true}
+
+	plain := &countReader{r: strings.NewReader(input)}
+	byter := &countByteReader{countReader{r: strings.NewReader(input)}}
+	for _, src := range []io.Reader{plain, byter} {
+		nread := func() int {
+			if c, ok := src.(*countByteReader); ok {
+				return c.nread
+			}
+			return src.(*countReader).nread
+		}
+		r := NewReader(src, opt)
+
+		// Each step reads or peeks some number of bits, then checks the total
+		// number of bytes consumed from the source.
+		tests := []struct {
+			peek  bool
+			nbits int
+			want  int
+		}{
+			{false, 1, 1},
+			{false, 7, 1},
+			{true, 1, 2},
+			{true, 12, 3},
+			{false, 3, 3},
+			{true, 64, 10},
+			{false, 64, 10},
+			{false, 5, 10},
+			{true, 3, 11},
+			{false, 8, 11},
+		}
+		for _, test := range tests {
+			var v uint64
+			var err error
+			if test.peek {
+				_, err = r.PeekBits(test.nbits, &v)
+			} else {
+				_, err = r.ReadBits(test.nbits, &v)
+			}
+			if err != nil {
+				t.Fatalf("Reading %d bits: unexpected error: %v", test.nbits, err)
+			}
+			if got := nread(); got != test.want {
+				t.Errorf("After %d bits (peek=%v): read %d bytes, want %d",
+					test.nbits, test.peek, got, test.want)
+			}
+		}
+
+		// The data delivered should be unaffected.
+		rest := make([]byte, len(input))
+		nr, _ := r.Read(rest)
+		if got, want := string(rest[:nr]), input[11:]; got != want {
+			t.Errorf("Remaining data: got %q, want %q", got, want)
+		}
+	}
+
+	// Variable-length codes do not wait for input past the end of the code.
+	// The writer does not close the pipe, so any further read would block.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go pw.Write([]byte{0x80, 0x10}) // ue(v)=0, then a run of 10 zeroes and a 1
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := NewReader(pr, opt)
+		if v, err := r.ReadExpGolomb(0); err != nil || v != 0 {
+			t.Errorf("ReadExpGolomb: got %d, %v; want 0, nil", v, err)
+		}
+		if n, err := r.ReadUnary(false, 64); err != nil || n != 10 {
+			t.Errorf("ReadUnary: got %d, %v; want 10, nil", n, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reading codes from a pipe did not complete")
 	}
 }
 
@@ -181,8 +449,11 @@ func TestWriterErrors(t *testing.T) {
 	saveBits := w.nb
 
 	// Writing enough to trigger a "real" write should give back an error.
+	var oe *OffsetError
 	if nw, err := w.WriteBits(failBits, 0); err == nil {
 		t.Errorf("Write(%d, 0): got %d, expected error", failBits, nw)
+	} else if !errors.As(err, &oe) || oe.Offset != okBits {
+		t.Errorf("Write(%d, 0): got error %v, want offset %d", failBits, err, okBits)
 	}
 
 	// Having gotten that error, the state of the system should be unchanged.
@@ -194,6 +465,218 @@ func TestWriterErrors(t *testing.T) {
 	}
 }
 
+func TestOffset(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	r := NewReader(&buf, nil)
+
+	// Each step writes the given number of bits, then checks the offset.
+	steps := []int{0, 3, 9, 64, 1, 7, 40, 64, 13}
+	want := int64(0)
+	for _, n := range steps {
+		if _, err := w.WriteBits(n, 0); err != nil {
+			t.Fatalf("WriteBits(%d): unexpected error: %v", n, err)
+		}
+		want += int64(n)
+		if got := w.Offset(); got != want {
+			t.Errorf("Writer offset after %d bits: got %d, want %d", n, got, want)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: unexpected error: %v", err)
+	}
+	want += (8 - want%8) % 8
+	if got := w.Offset(); got != want {
+		t.Errorf("Writer offset after Flush: got %d, want %d", got, want)
+	}
+
+	want = 0
+	for _, n := range steps {
+		if n%2 == 0 {
+			_, err := r.ReadBits(n, nil)
+			if err != nil {
+				t.Fatalf("ReadBits(%d): unexpected error: %v", n, err)
+			}
+		} else if _, err := r.SkipBits(n); err != nil {
+			t.Fatalf("SkipBits(%d): unexpected error: %v", n, err)
+		}
+		want += int64(n)
+		if got := r.Offset(); got != want {
+			t.Errorf("Reader offset after %d bits: got %d, want %d", n, got, want)
+		}
+	}
+
+	// Errors report the offset where they occurred.
+	var oe *OffsetError
+	if _, err := r.ReadBits(65, nil); !errors.As(err, &oe) || !errors.Is(err, ErrCountRange) {
+		t.Errorf("ReadBits(65): got error %v, want %v", err, ErrCountRange)
+	} else if oe.Offset != want {
+		t.Errorf("ReadBits(65): error offset is %d, want %d", oe.Offset, want)
+	}
+}
+
+func TestWriterAlign(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+
+	check := func(label string, got, want int, err error) {
+		t.Helper()
+		if err != nil || got != want {
+			t.Errorf("%s: got %d, %v; want %d, nil", label, got, err, want)
+		}
+	}
+
+	n, err := w.Align(true)
+	check("Align at start", n, 0, err)
+
+	w.WriteBits(3, 0)
+	n, err = w.Align(true) // 000 11111
+	check("Align(true)", n, 5, err)
+
+	w.WriteBits(1, 1)
+	n, err = w.Align(false) // 1000 0000
+	check("Align(false)", n, 7, err)
+
+	w.WriteBits(4, 5)
+	n, err = w.AlignTo(12, true) // 0101 1111
+	check("AlignTo(12, true)", n, 4, err)
+
+	n, err = w.AlignTo(100, false) // zero bits to offset 100
+	check("AlignTo(100, false)", n, 76, err)
+	if got := w.Offset(); got != 100 {
+		t.Errorf("Offset after AlignTo: got %d, want 100", got)
+	}
+
+	// Nothing should have been written to the underlying writer until the
+	// buffer filled, which happens once at 64 bits.
+	if got := buf.Len(); got != 8 {
+		t.Errorf("Buffered output: got %d bytes, want 8", got)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: unexpected error: %v", err)
+	}
+	const want = "\x1f\x80\x5f" + "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	if got := buf.String(); got != want {
+		t.Errorf("Output: got %q, want %q", got, want)
+	}
+
+	if _, err := w.AlignTo(0, false); !errors.Is(err, ErrCountRange) {
+		t.Errorf("AlignTo(0): got %v, want %v", err, ErrCountRange)
+	}
+}
+
+func TestRepeatedFlush(t *testing.T) {
+	// Padding is added only when bits have been written since the last Flush.
+	tests := []struct {
+		name string
+		pad  PadMode
+		want string
+	}{
+		{"Zeros", PadZeros, "\xaa\x00"},
+		{"Ones", PadOnes, "\xaa\x1f"},
+		{"StopBit", PadStopBit, "\xaa\x80\x10"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, &Options{Padding: test.pad})
+		w.Flush()
+		w.WriteBits(8, 0xaa)
+		w.Flush()
+		w.Flush()
+		w.WriteBits(3, 0)
+		w.Flush()
+		w.Flush()
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPadding(t *testing.T) {
+	tests := []struct {
+		name  string
+		pad   PadMode
+		nbits int    // number of zero bits to write before flushing
+		want  string // expected output after flushing
+	}{
+		{"Zeros", PadZeros, 3, "\x00"},
+		{"Zeros", PadZeros, 8, "\x00"},
+		{"Zeros", PadZeros, 0, ""},
+		{"Ones", PadOnes, 3, "\x1f"},
+		{"Ones", PadOnes, 13, "\x00\x07"},
+		{"Ones", PadOnes, 16, "\x00\x00"},
+		{"StopBit", PadStopBit, 3, "\x10"},
+		{"StopBit", PadStopBit, 7, "\x01"},
+		{"StopBit", PadStopBit, 8, "\x00\x80"},
+		{"StopBit", PadStopBit, 60, "\x00\x00\x00\x00\x00\x00\x00\x08"},
+		{"StopBit", PadStopBit, 64, "\x00\x00\x00\x00\x00\x00\x00\x00\x80"},
+		{"Pattern", PadPattern, 2, "\x25"},
+		{"Pattern", PadPattern, 5, "\x05"},
+		{"Pattern", PadPattern, 8, "\x00"},
+	}
+	for _, test := range tests {
+		for _, lsb := range []bool{false, true} {
+			// The pattern is ignored by the other modes.
+			opt := &Options{LowBitFirst: lsb, Padding: test.pad, PadBits: 0xa5}
+			want := flippedIf(test.want, opt)
+
+			var buf bytes.Buffer
+			w := NewWriter(&buf, opt)
+			w.WriteBits(test.nbits, 0)
+			if err := w.Flush(); err != nil {
+				t.Errorf("%s/%d: Flush failed: %v", test.name, test.nbits, err)
+				continue
+			}
+			if got := buf.String(); got != want {
+				t.Errorf("%s/%d: got %q, want %q", test.name, test.nbits, got, want)
+			}
+
+			// A Reader with the same options should accept the padding.
+			r := NewReader(strings.NewReader(want), opt)
+			r.SkipBits(test.nbits)
+			if _, err := r.Align(true); err != nil {
+				t.Errorf("%s/%d: Align failed: %v", test.name, test.nbits, err)
+			}
+			if n, err := r.ReadBits(1, nil); err != io.EOF || n != 0 {
+				t.Errorf("%s/%d: ReadBits after Align: got %d, %v; want 0, EOF", test.name, test.nbits, n, err)
+			}
+		}
+	}
+
+	// A Reader with a different policy should reject the padding.
+	r := NewReader(strings.NewReader("\x1f"), &Options{Padding: PadStopBit})
+	r.SkipBits(3)
+	var pe *PaddingError
+	if _, err := r.Align(true); !errors.As(err, &pe) {
+		t.Errorf("Align: got %v, want *PaddingError", err)
+	} else if pe.Count != 5 || pe.Got != 0x1f || pe.Want != 0x10 {
+		t.Errorf("Align: got %+v, want count 5, got 11111, want 10000", pe)
+	}
+
+	// Options are comparable.
+	opt := Options{Padding: PadPattern, PadBits: 0xa5}
+	if got := NewWriter(io.Discard, &opt).Options(); got != opt {
+		t.Errorf("Options: got %+v, want %+v", got, opt)
+	}
+
+	// An undefined padding mode is rejected when the Reader or Writer is
+	// constructed.
+	bogus := &Options{Padding: PadMode(99)}
+	for name, construct := range map[string]func(){
+		"NewReader": func() { NewReader(strings.NewReader(""), bogus) },
+		"NewWriter": func() { NewWriter(io.Discard, bogus) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s with %v: did not panic", name, bogus.Padding)
+				}
+			}()
+			construct()
+		}()
+	}
+}
+
 func TestReadBytes(t *testing.T) {
 	const baseValue = "0123456789abcd"
 	tests := []struct {
@@ -250,9 +733,184 @@ func TestWriteBytes(t *testing.T) {
 	}
 }
 
+func TestRemainder(t *testing.T) {
+	const input = "\x5a\xc3The quick brown fox jumps over the lazy dog"
+	for _, opt := range []*Options{nil, {LowBitFirst: true}, {NoReadAhead: true}} {
+		for _, peek := range []int{0, 4, 64} {
+			r := NewReader(strings.NewReader(flippedIf(input[:2], opt)+input[2:]), opt)
+
+			var hi, lo uint64
+			r.ReadBits(4, &hi)
+			if _, err := r.Remainder(); !errors.Is(err, ErrNotAligned) {
+				t.Errorf("Remainder when unaligned: got %v, want %v", err, ErrNotAligned)
+			}
+			r.ReadBits(12, &lo)
+			if hi != 0x5 || lo != 0xac3 {
+				t.Errorf("Header: got %x, %x; want 5, ac3", hi, lo)
+			}
+			r.PeekBits(peek, nil)
+
+			rest, err := r.Remainder()
+			if err != nil {
+				t.Fatalf("Remainder: unexpected error: %v", err)
+			}
+			got, err := io.ReadAll(rest)
+			if err != nil {
+				t.Errorf("Reading remainder: unexpected error: %v", err)
+			}
+			if want := input[2:]; string(got) != want {
+				t.Errorf("Remainder (peek=%d, opt=%+v): got %q, want %q", peek, opt, got, want)
+			}
+		}
+	}
+}
+
+// countWriter is an io.Writer that records the calls made to it.  If fail is
+// set, writes fail with that error.
+type countWriter struct {
+	bytes.Buffer
+	nwrites int
+	fail    error
+}
+
+func (c *countWriter) Write(data []byte) (int, error) {
+	if c.fail != nil {
+		return 0, c.fail
+	}
+	c.nwrites++
+	return c.Buffer.Write(data)
+}
+
+func TestBufferSize(t *testing.T) {
+	const bufSize = 64
+	input := strings.Repeat("All work and no play makes Jack a dull boy. ", 10)
+	opt := &Options{BufferSize: bufSize}
+
+	// Write the input in awkward chunks, and verify that the writer batches
+	// its output into buffer-sized writes.
+	out := &countWriter{}
+	w := NewWriter(out, opt)
+	for i := 0; i < len(input); i++ {
+		if _, err := w.WriteBits(8, uint64(input[i])); err != nil {
+			t.Fatalf("WriteBits failed: %v", err)
+		}
+	}
+	w.WriteBits(3, 5)
+	if got, want := out.Len(), bufSize*(len(input)/bufSize); got != want {
+		t.Errorf("Before flush: got %d bytes, want %d", got, want)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got, want := out.nwrites, len(input)/bufSize+1; got != want {
+		t.Errorf("Got %d writes, want %d", got, want)
+	}
+	if got, want := out.String(), input+"\xa0"; got != want {
+		t.Errorf("Output: got %q, want %q", got, want)
+	}
+
+	// A failed write does not modify the state of the writer, even when the
+	// output buffer holds pending data.
+	out = &countWriter{fail: errors.New("bogus")}
+	w = NewWriter(out, opt)
+	w.Write([]byte(input[:bufSize-3]))
+	if _, err := w.WriteBits(64, 0); err == nil {
+		t.Error("WriteBits: got nil, want error")
+	}
+	if _, err := w.Write([]byte(input[bufSize-3:])); err == nil {
+		t.Error("Write: got nil, want error")
+	}
+	if err := w.Flush(); err == nil {
+		t.Error("Flush: got nil, want error")
+	}
+	out.fail = nil
+	if _, err := w.Write([]byte(input[bufSize-3:])); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got := out.String(); got != input {
+		t.Errorf("Output after failure: got %q, want %q", got, input)
+	}
+
+	// The reader should fetch buffer-sized blocks from its source.
+	src := &countReader{r: strings.NewReader(input)}
+	r := NewReader(src, opt)
+	var v uint64
+	r.ReadBits(1, &v)
+	if src.nread != bufSize {
+		t.Errorf("After first read: got %d bytes, want %d", src.nread, bufSize)
+	}
+	r.PeekBits(64, &v)
+	r.SkipBits(8*(bufSize+3) - 1) // skip whole bytes past the buffer
+	if got, want := src.nread, bufSize+3; got != want {
+		t.Errorf("After skip: got %d bytes, want %d", got, want)
+	}
+	if got, err := io.ReadAll(must(r.Remainder())); err != nil {
+		t.Errorf("Reading remainder: %v", err)
+	} else if want := input[bufSize+3:]; string(got) != want {
+		t.Errorf("Remainder: got %q, want %q", got, want)
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestReset(t *testing.T) {
+	var r Reader
+	var w Writer
+	for i, opt := range []*Options{nil, {LowBitFirst: true}, {BufferSize: 32}, nil} {
+		// Leave some state behind in the reader and writer.
+		if i > 0 {
+			r.ReadBits(3, nil)
+			r.PeekBits(40, nil)
+			w.WriteBits(37, 12345)
+		}
+
+		msg := fmt.Sprintf("message %d", i)
+		var buf bytes.Buffer
+		w.Reset(&buf, opt)
+		if got := w.Offset(); got != 0 {
+			t.Errorf("Writer offset after Reset: got %d, want 0", got)
+		}
+		w.WriteBits(5, 21)
+		w.Write([]byte(msg))
+		w.Flush()
+
+		r.Reset(&buf, opt)
+		if got := r.Offset(); got != 0 {
+			t.Errorf("Reader offset after Reset: got %d, want 0", got)
+		}
+		var v uint64
+		r.ReadBits(5, &v)
+		got := make([]byte, len(msg))
+		r.Read(got)
+		if v != 21 || string(got) != msg {
+			t.Errorf("After Reset: got %d, %q; want 21, %q", v, got, msg)
+		}
+	}
+
+	// Resetting with the same buffer size should not allocate.
+	opt := &Options{BufferSize: 100}
+	src := strings.NewReader("")
+	r.Reset(src, opt)
+	w.Reset(io.Discard, opt)
+	if n := testing.AllocsPerRun(100, func() {
+		r.Reset(src, opt)
+		w.Reset(io.Discard, opt)
+	}); n != 0 {
+		t.Errorf("Reset: got %v allocations, want 0", n)
+	}
+}
+
 func TestRoundTrip(t *testing.T) {
 	for _, input := range []string{"", "a", "ab", "abc", "abcdefghijklmopqrstuv", "01a23"} {
-		for _, opt := range []*Options{nil, {LowBitFirst: true}} {
+		for _, opt := range []*Options{nil, {LowBitFirst: true}, {BufferSize: 13}, {BufferSize: 4096}} {
 			var buf bytes.Buffer
 
 			// Write the input out to the buffer.
@@ -308,3 +966,1011 @@ func ExampleWriter_WriteBits() {
 	fmt.Print(output.String())
 	// Output: A
 }
+
+// zeroReader is an io.Reader that delivers an endless stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(data []byte) (int, error) {
+	clear(data)
+	return len(data), nil
+}
+
+func TestAllocs(t *testing.T) {
+	r := NewReader(zeroReader{}, &Options{LowBitFirst: true})
+	w := NewWriter(io.Discard, &Options{LowBitFirst: true})
+	data := make([]byte, 37)
+
+	tests := []struct {
+		name string
+		op   func()
+	}{
+		{"ReadBits", func() { r.ReadBits(13, nil) }},
+		{"PeekBits", func() { r.PeekBits(64, nil); r.ReadBits(3, nil) }},
+		{"ReadBit", func() { r.ReadBit() }},
+		{"ReadByte", func() { r.ReadByte() }},
+		{"Read", func() { r.Read(data) }},
+		{"WriteBits", func() { w.WriteBits(13, 0x1234) }},
+		{"WriteBit", func() { w.WriteBit(true) }},
+		{"WriteByte", func() { w.WriteByte(0x5a) }},
+		{"Write", func() { w.Write(data) }},
+		{"Flush", func() { w.WriteBits(3, 5); w.Flush() }},
+	}
+	for _, test := range tests {
+		if n := testing.AllocsPerRun(100, test.op); n != 0 {
+			t.Errorf("%s: got %v allocations, want 0", test.name, n)
+		}
+	}
+}
+
+func BenchmarkReadBits(b *testing.B) {
+	for _, n := range []int{1, 7, 13, 64} {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			r := NewReader(zeroReader{}, nil)
+			var v uint64
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r.ReadBits(n, &v)
+			}
+		})
+	}
+}
+
+func BenchmarkWriteBits(b *testing.B) {
+	for _, n := range []int{1, 7, 13, 64} {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			w := NewWriter(io.Discard, nil)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w.WriteBits(n, uint64(i))
+			}
+		})
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	r := NewReader(zeroReader{}, nil)
+	data := make([]byte, 1024)
+	r.ReadBits(3, nil) // misalign the stream
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Read(data)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	w := NewWriter(io.Discard, nil)
+	data := make([]byte, 1024)
+	w.WriteBits(3, 0) // misalign the stream
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.Write(data)
+	}
+}
+
+func TestWide(t *testing.T) {
+	// A 200-bit value with distinct bytes, and its big.Int equivalent.
+	wide := make([]byte, 25)
+	for i := range wide {
+		wide[i] = byte(0x11 * (i + 1))
+	}
+	z := new(big.Int).SetBytes(wide)
+
+	for _, opt := range []*Options{nil, {LowBitFirst: true}} {
+		for _, count := range []int{0, 1, 7, 8, 63, 64, 65, 100, 128, 129, 200} {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, opt)
+
+			// Write the value three ways, with misaligned separators.
+			u128 := [2]uint64{
+				binary.BigEndian.Uint64(wide[9:17]),
+				binary.BigEndian.Uint64(wide[17:]),
+			}
+			w.WriteBits(3, 5)
+			if _, err := w.WriteWide(count, wide); err != nil {
+				t.Fatalf("WriteWide(%d): unexpected error: %v", count, err)
+			}
+			w.WriteBits(3, 5)
+			if _, err := w.WriteBig(count, z); err != nil {
+				t.Fatalf("WriteBig(%d): unexpected error: %v", count, err)
+			}
+			w.WriteBits(3, 5)
+			if count <= 128 {
+				if _, err := w.WriteUint128(count, u128); err != nil {
+					t.Fatalf("WriteUint128(%d): unexpected error: %v", count, err)
+				}
+			}
+			w.Flush()
+
+			// The expected value is the low-order count bits of the input.
+			want := new(big.Int).And(z, lowBits(count))
+
+			r := NewReader(&buf, opt)
+			r.SkipBits(3)
+			got := make([]byte, 26)
+			if n, err := r.ReadWide(count, got); err != nil || n != count {
+				t.Errorf("ReadWide(%d): got %d, %v; want %d, nil", count, n, err, count)
+			} else if g := new(big.Int).SetBytes(got); g.Cmp(want) != 0 {
+				t.Errorf("ReadWide(%d): got %x, want %x", count, g, want)
+			}
+			r.SkipBits(3)
+			gz := new(big.Int)
+			if n, err := r.ReadBig(count, gz); err != nil || n != count {
+				t.Errorf("ReadBig(%d): got %d, %v; want %d, nil", count, n, err, count)
+			} else if gz.Cmp(want) != 0 {
+				t.Errorf("ReadBig(%d): got %x, want %x", count, gz, want)
+			}
+			r.SkipBits(3)
+			if count <= 128 {
+				var gv [2]uint64
+				if n, err := r.ReadUint128(count, &gv); err != nil || n != count {
+					t.Errorf("ReadUint128(%d): got %d, %v; want %d, nil", count, n, err, count)
+				} else if g := new(big.Int).SetBytes(binary.BigEndian.AppendUint64(
+					binary.BigEndian.AppendUint64(nil, gv[0]), gv[1])); g.Cmp(want) != 0 {
+					t.Errorf("ReadUint128(%d): got %x, want %x", count, g, want)
+				}
+			}
+		}
+	}
+
+	// Short reads leave the available bits in the low-order positions.
+	const input = "\x01\x23\x45\x67\x89\xab\xcd\xef\xfe\xdc\xba\x98\x76\x54\x32\x10\xff"
+	for _, skip := range []int{0, 4, 60, 64, 68} {
+		want := new(big.Int).SetBytes([]byte(input))
+		want.And(want, lowBits(8*len(input)-skip))
+
+		r := NewReader(strings.NewReader(input), nil)
+		r.SkipBits(skip)
+		got := new(big.Int)
+		if n, err := r.ReadBig(200, got); err != io.EOF || n != 8*len(input)-skip {
+			t.Errorf("ReadBig(200) after %d: got %d, %v; want %d, EOF", skip, n, err, 8*len(input)-skip)
+		} else if got.Cmp(want) != 0 {
+			t.Errorf("ReadBig(200) after %d: got %x, want %x", skip, got, want)
+		}
+
+		r = NewReader(strings.NewReader(input[:15]), nil)
+		r.SkipBits(skip)
+		var gv [2]uint64
+		if n, err := r.ReadUint128(128, &gv); err != io.EOF || n != 120-skip {
+			t.Errorf("ReadUint128(128) after %d: got %d, %v; want %d, EOF", skip, n, err, 120-skip)
+		} else if want := new(big.Int).Rsh(want, 16); gv[0] != new(big.Int).Rsh(want, 64).Uint64() || gv[1] != want.Uint64() {
+			t.Errorf("ReadUint128(128) after %d: got %x, want %x", skip, gv, want)
+		}
+	}
+
+	// Two's complement is used for negative values.
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	w.WriteBig(12, big.NewInt(-2))
+	w.Flush()
+	if got, want := buf.String(), "\xff\xe0"; got != want {
+		t.Errorf("WriteBig(12, -2): got %q, want %q", got, want)
+	}
+
+	// A huge count is bounded by the input, not allocated in advance.
+	for _, opt := range []*Options{nil, {LowBitFirst: true, FieldLowBitFirst: true}} {
+		for _, count := range []int{1 << 40, math.MaxInt} {
+			got := new(big.Int)
+			r := NewReader(strings.NewReader("\x01\x02\x03"), opt)
+			want := int64(0x010203)
+			if opt != nil {
+				want = 0x030201 // the first byte read holds the low-order bits
+			}
+			if n, err := r.ReadBig(count, got); err != io.EOF || n != 24 {
+				t.Errorf("%+v ReadBig(%d): got %d, %v; want 24, EOF", opt, count, n, err)
+			} else if got.Cmp(big.NewInt(want)) != 0 {
+				t.Errorf("%+v ReadBig(%d): got %x, want %x", opt, count, got, want)
+			}
+		}
+
+		// The high-order bits of a wide field repeat the sign.
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opt)
+		if n, err := w.WriteBig(1<<20, big.NewInt(-2)); err != nil || n != 1<<20 {
+			t.Fatalf("%+v WriteBig(1<<20, -2): got %d, %v; want %d, nil", opt, n, err, 1<<20)
+		}
+		w.Flush()
+		want := bytes.Repeat([]byte{0xff}, 1<<17)
+		if opt == nil {
+			want[len(want)-1] = 0xfe
+		} else {
+			want[0] = 0xfe // the low-order bit comes first
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%+v WriteBig(1<<20, -2): wrong output", opt)
+		}
+
+		// A huge count fails at the first write to the underlying writer.
+		w = NewWriter(errWriter("bogus"), opt)
+		if _, err := w.WriteBig(math.MaxInt, big.NewInt(5)); err == nil {
+			t.Errorf("%+v WriteBig(MaxInt, 5): got nil, want error", opt)
+		}
+	}
+
+	if _, err := w.WriteWide(17, make([]byte, 2)); !errors.Is(err, ErrCountRange) {
+		t.Errorf("WriteWide(17, [2]): got %v, want %v", err, ErrCountRange)
+	}
+	if _, err := NewReader(&buf, nil).ReadUint128(129, new([2]uint64)); !errors.Is(err, ErrCountRange) {
+		t.Errorf("ReadUint128(129): got %v, want %v", err, ErrCountRange)
+	}
+}
+
+// lowBits returns a mask of the low-order n bits.
+func lowBits(n int) *big.Int {
+	one := big.NewInt(1)
+	return new(big.Int).Sub(new(big.Int).Lsh(one, uint(n)), one)
+}
+
+func TestSigned(t *testing.T) {
+	modes := []SignMode{TwosComplement, SignMagnitude, OnesComplement, OffsetBinary}
+
+	// Check the representations of some specific values.
+	tests := []struct {
+		count int
+		value int64
+		want  [4]uint64 // by mode, in the order above
+	}{
+		{4, 0, [4]uint64{0x0, 0x0, 0x0, 0x8}},
+		{4, 3, [4]uint64{0x3, 0x3, 0x3, 0xb}},
+		{4, -3, [4]uint64{0xd, 0xb, 0xc, 0x5}},
+		{4, 7, [4]uint64{0x7, 0x7, 0x7, 0xf}},
+		{4, -7, [4]uint64{0x9, 0xf, 0x8, 0x1}},
+		{13, -1000, [4]uint64{0x1c18, 0x13e8, 0x1c17, 0x0c18}},
+		{64, -1, [4]uint64{1<<64 - 1, 1<<63 | 1, 1<<64 - 2, 1<<63 - 1}},
+	}
+	for _, test := range tests {
+		for i, mode := range modes {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, nil)
+			w.WriteBits(3, 0)
+			if _, err := w.WriteSigned(test.count, mode, test.value); err != nil {
+				t.Errorf("WriteSigned(%d, %v, %d): unexpected error: %v", test.count, mode, test.value, err)
+				continue
+			}
+			w.Flush()
+
+			r := NewReader(bytes.NewReader(buf.Bytes()), nil)
+			var raw uint64
+			r.SkipBits(3)
+			r.PeekBits(test.count, &raw)
+			if raw != test.want[i] {
+				t.Errorf("WriteSigned(%d, %v, %d): wrote %x, want %x", test.count, mode, test.value, raw, test.want[i])
+			}
+			var got int64
+			if _, err := r.ReadSigned(test.count, mode, &got); err != nil {
+				t.Errorf("ReadSigned(%d, %v): unexpected error: %v", test.count, mode, err)
+			} else if got != test.value {
+				t.Errorf("ReadSigned(%d, %v): got %d, want %d", test.count, mode, got, test.value)
+			}
+		}
+	}
+
+	// Check the boundaries of each representation.
+	for _, mode := range modes {
+		for _, count := range []int{1, 2, 13, 63, 64} {
+			lo, hi := mode.Range(count)
+			w := NewWriter(io.Discard, nil)
+			for _, v := range []int64{lo, hi} {
+				if _, err := w.WriteSigned(count, mode, v); err != nil {
+					t.Errorf("WriteSigned(%d, %v, %d): unexpected error: %v", count, mode, v, err)
+				}
+			}
+			for _, v := range []int64{lo - 1, hi + 1} {
+				if v == lo-1 && lo == math.MinInt64 || v == hi+1 && hi == math.MaxInt64 {
+					continue // not representable
+				}
+				var re *RangeError
+				if _, err := w.WriteSigned(count, mode, v); !errors.As(err, &re) {
+					t.Errorf("WriteSigned(%d, %v, %d): got %v, want *RangeError", count, mode, v, err)
+				} else if re.Count != count || int64(re.Value) != v {
+					t.Errorf("WriteSigned(%d, %v, %d): got %+v", count, mode, v, re)
+				}
+			}
+			if got := w.Offset(); got != 2*int64(count) {
+				t.Errorf("After range errors: offset is %d, want %d", got, 2*count)
+			}
+		}
+	}
+
+	// Negative zero decodes as zero.
+	var v int64
+	r := NewReader(strings.NewReader("\x8f"), nil)
+	if r.ReadSigned(4, SignMagnitude, &v); v != 0 {
+		t.Errorf("ReadSigned(4, SignMagnitude) of -0: got %d, want 0", v)
+	}
+	if r.ReadSigned(4, OnesComplement, &v); v != 0 {
+		t.Errorf("ReadSigned(4, OnesComplement) of -0: got %d, want 0", v)
+	}
+	if _, err := r.ReadSigned(0, TwosComplement, &v); !errors.Is(err, ErrCountRange) {
+		t.Errorf("ReadSigned(0): got %v, want %v", err, ErrCountRange)
+	}
+}
+
+func TestBitAndByte(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, &Options{LowBitFirst: true})
+
+	// Write a pattern of bits long enough to cross the buffer boundary.
+	var want []bool
+	for i := 0; i < 150; i++ {
+		bit := i%3 == 0 || i%7 == 0
+		want = append(want, bit)
+		if err := w.WriteBit(bit); err != nil {
+			t.Fatalf("WriteBit %d: unexpected error: %v", i, err)
+		}
+	}
+	if got := w.Offset(); got != 150 {
+		t.Errorf("Offset after WriteBit: got %d, want 150", got)
+	}
+
+	// Follow with a varint, written via the io.ByteWriter interface.
+	const varint = 300
+	var vbuf [binary.MaxVarintLen64]byte
+	for _, b := range vbuf[:binary.PutUvarint(vbuf[:], varint)] {
+		if err := w.WriteByte(b); err != nil {
+			t.Fatalf("WriteByte: unexpected error: %v", err)
+		}
+	}
+	w.Flush()
+
+	r := NewReader(&buf, &Options{LowBitFirst: true})
+	for i, bit := range want {
+		got, err := r.ReadBit()
+		if err != nil {
+			t.Fatalf("ReadBit %d: unexpected error: %v", i, err)
+		}
+		if got != bit {
+			t.Errorf("ReadBit %d: got %v, want %v", i, got, bit)
+		}
+	}
+	if v, err := binary.ReadUvarint(r); err != nil || v != varint {
+		t.Errorf("ReadUvarint: got %d, %v; want %d, nil", v, err, varint)
+	}
+
+	// Only 2 bits of padding remain, so ReadByte gets a short read.
+	if _, err := r.ReadByte(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadByte: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte at end: got %v, want EOF", err)
+	}
+	if _, err := r.ReadBit(); err != io.EOF {
+		t.Errorf("ReadBit at end: got %v, want EOF", err)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	type myByte uint8
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	check := func(label string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", label, err)
+		}
+	}
+	check("WriteUint[uint8]", WriteUint(w, 5, uint8(19)))
+	check("WriteUint[myByte]", WriteUint(w, 8, myByte(255)))
+	check("WriteUint[uint16]", WriteUint(w, 13, uint16(5000)))
+	check("WriteUint[uint64]", WriteUint(w, 64, uint64(math.MaxUint64)))
+	check("WriteInt[int32]", WriteInt(w, 13, int32(-4096)))
+	check("WriteInt[int8]", WriteInt(w, 8, int8(127)))
+	check("WriteInt[int]", WriteInt(w, 3, -1))
+
+	// Values that do not fit are rejected without writing anything.
+	var re *RangeError
+	if err := WriteUint(w, 5, uint8(32)); !errors.As(err, &re) {
+		t.Errorf("WriteUint(5, 32): got %v, want *RangeError", err)
+	} else if re.Count != 5 || re.Value != 32 {
+		t.Errorf("WriteUint(5, 32): got %+v", re)
+	}
+	if err := WriteInt(w, 13, int32(4096)); !errors.As(err, &re) {
+		t.Errorf("WriteInt(13, 4096): got %v, want *RangeError", err)
+	}
+
+	// Widths that exceed the type are rejected.
+	if err := WriteUint(w, 9, uint8(0)); !errors.Is(err, ErrCountRange) {
+		t.Errorf("WriteUint[uint8](9): got %v, want %v", err, ErrCountRange)
+	}
+	if err := WriteInt(w, 17, int16(0)); !errors.Is(err, ErrCountRange) {
+		t.Errorf("WriteInt[int16](17): got %v, want %v", err, ErrCountRange)
+	}
+	dw := NewWriter(io.Discard, nil)
+	for _, test := range []struct {
+		name  string
+		width int
+		write func(int) error
+	}{
+		{"uint8", 8, func(n int) error { return WriteUint(dw, n, uint8(0)) }},
+		{"uint16", 16, func(n int) error { return WriteUint(dw, n, uint16(0)) }},
+		{"uint32", 32, func(n int) error { return WriteUint(dw, n, uint32(0)) }},
+		{"uint64", 64, func(n int) error { return WriteUint(dw, n, uint64(0)) }},
+		{"uint", bits.UintSize, func(n int) error { return WriteUint(dw, n, uint(0)) }},
+		{"int8", 8, func(n int) error { return WriteInt(dw, n, int8(0)) }},
+		{"int16", 16, func(n int) error { return WriteInt(dw, n, int16(0)) }},
+		{"int32", 32, func(n int) error { return WriteInt(dw, n, int32(0)) }},
+		{"int64", 64, func(n int) error { return WriteInt(dw, n, int64(0)) }},
+		{"int", bits.UintSize, func(n int) error { return WriteInt(dw, n, 0) }},
+	} {
+		if err := test.write(test.width); err != nil {
+			t.Errorf("Write[%s](%d): unexpected error: %v", test.name, test.width, err)
+		}
+		if err := test.write(test.width + 1); !errors.Is(err, ErrCountRange) {
+			t.Errorf("Write[%s](%d): got %v, want %v", test.name, test.width+1, err, ErrCountRange)
+		}
+	}
+	w.Flush()
+	if got, want := w.Offset(), int64(120); got != want {
+		t.Errorf("Offset: got %d, want %d", got, want)
+	}
+
+	r := NewReader(&buf, nil)
+	if v, err := ReadUint[uint8](r, 5); err != nil || v != 19 {
+		t.Errorf("ReadUint[uint8](5): got %d, %v; want 19, nil", v, err)
+	}
+	if v, err := ReadUint[myByte](r, 8); err != nil || v != 255 {
+		t.Errorf("ReadUint[myByte](8): got %d, %v; want 255, nil", v, err)
+	}
+	if v, err := ReadUint[uint16](r, 13); err != nil || v != 5000 {
+		t.Errorf("ReadUint[uint16](13): got %d, %v; want 5000, nil", v, err)
+	}
+	if _, err := ReadUint[uint32](r, 33); !errors.Is(err, ErrCountRange) {
+		t.Errorf("ReadUint[uint32](33): got %v, want %v", err, ErrCountRange)
+	}
+	if v, err := ReadUint[uint64](r, 64); err != nil || v != math.MaxUint64 {
+		t.Errorf("ReadUint[uint64](64): got %d, %v; want max, nil", v, err)
+	}
+	if v, err := ReadInt[int32](r, 13); err != nil || v != -4096 {
+		t.Errorf("ReadInt[int32](13): got %d, %v; want -4096, nil", v, err)
+	}
+	if v, err := ReadInt[int8](r, 8); err != nil || v != 127 {
+		t.Errorf("ReadInt[int8](8): got %d, %v; want 127, nil", v, err)
+	}
+	if v, err := ReadInt[int](r, 3); err != nil || v != -1 {
+		t.Errorf("ReadInt[int](3): got %d, %v; want -1, nil", v, err)
+	}
+	if _, err := ReadUint[uint16](r, 16); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadUint at end: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := ReadInt[int16](r, 1); err != io.EOF {
+		t.Errorf("ReadInt at end: got %v, want EOF", err)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	// In the default mode, excess high-order bits are discarded and do not
+	// clobber previously-written data.
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	w.WriteBits(4, 0xa)
+	w.WriteBits(4, 0xff3)
+	w.WriteBits(60, 0)
+	w.WriteBits(4, 0xfffffffffffffff5)
+	w.Flush()
+	if got, want := buf.String(), "\xa3\x00\x00\x00\x00\x00\x00\x00\x05"; got != want {
+		t.Errorf("Non-strict output: got %q, want %q", got, want)
+	}
+
+	// In strict mode, excess bits are reported as errors.
+	buf.Reset()
+	w = NewWriter(&buf, &Options{Strict: true})
+	w.WriteBits(4, 0xa)
+	var re *RangeError
+	if _, err := w.WriteBits(4, 0x13); !errors.As(err, &re) {
+		t.Errorf("WriteBits(4, 0x13): got %v, want *RangeError", err)
+	} else if re.Count != 4 || re.Value != 0x13 {
+		t.Errorf("WriteBits(4, 0x13): got %+v", re)
+	}
+	if _, err := w.WriteBits(0, 1); !errors.As(err, &re) {
+		t.Errorf("WriteBits(0, 1): got %v, want *RangeError", err)
+	}
+	for _, test := range []struct {
+		count int
+		v     uint64
+	}{{4, 3}, {0, 0}, {64, math.MaxUint64}, {1, 1}, {3, 0}} {
+		if _, err := w.WriteBits(test.count, test.v); err != nil {
+			t.Errorf("WriteBits(%d, %x): unexpected error: %v", test.count, test.v, err)
+		}
+	}
+	w.Flush()
+	if got, want := buf.String(), "\xa3\xff\xff\xff\xff\xff\xff\xff\xff\x80"; got != want {
+		t.Errorf("Strict output: got %q, want %q", got, want)
+	}
+
+	// Wide writers also report excess bits, and write nothing.
+	w = NewWriter(io.Discard, &Options{Strict: true})
+	bad := []struct {
+		name  string
+		write func() (int, error)
+	}{
+		{"WriteWide(12)", func() (int, error) { return w.WriteWide(12, []byte{0x10, 0x00}) }},
+		{"WriteWide(64)", func() (int, error) { return w.WriteWide(64, []byte("\x01\x00\x00\x00\x00\x00\x00\x00\x00")) }},
+		{"WriteWide(0)", func() (int, error) { return w.WriteWide(0, []byte{1}) }},
+		{"WriteUint128(70)", func() (int, error) { return w.WriteUint128(70, [2]uint64{1 << 6, 0}) }},
+		{"WriteUint128(10)", func() (int, error) { return w.WriteUint128(10, [2]uint64{0, 1 << 10}) }},
+		{"WriteUint128(64)", func() (int, error) { return w.WriteUint128(64, [2]uint64{1, 0}) }},
+		{"WriteBig(8, 256)", func() (int, error) { return w.WriteBig(8, big.NewInt(256)) }},
+		{"WriteBig(8, -129)", func() (int, error) { return w.WriteBig(8, big.NewInt(-129)) }},
+	}
+	for _, test := range bad {
+		if n, err := test.write(); !errors.As(err, &re) || n != 0 {
+			t.Errorf("%s: got %d, %v; want 0, *RangeError", test.name, n, err)
+		} else if re.Big == nil {
+			t.Errorf("%s: RangeError has no value: %+v", test.name, re)
+		}
+	}
+	if w.Offset() != 0 {
+		t.Errorf("Offset after errors: got %d, want 0", w.Offset())
+	}
+	good := []struct {
+		name  string
+		write func() (int, error)
+	}{
+		{"WriteWide(12)", func() (int, error) { return w.WriteWide(12, []byte{0x0f, 0xff}) }},
+		{"WriteWide(72)", func() (int, error) { return w.WriteWide(72, []byte("\xff\x00\x00\x00\x00\x00\x00\x00\x01")) }},
+		{"WriteUint128(70)", func() (int, error) { return w.WriteUint128(70, [2]uint64{1<<6 - 1, math.MaxUint64}) }},
+		{"WriteUint128(128)", func() (int, error) { return w.WriteUint128(128, [2]uint64{math.MaxUint64, 1}) }},
+		{"WriteBig(8, 255)", func() (int, error) { return w.WriteBig(8, big.NewInt(255)) }},
+		{"WriteBig(8, -128)", func() (int, error) { return w.WriteBig(8, big.NewInt(-128)) }},
+	}
+	for _, test := range good {
+		if _, err := test.write(); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestExpGolomb(t *testing.T) {
+	// Check the encodings of some specific values.
+	tests := []struct {
+		k    int
+		v    uint64
+		want string // bits
+	}{
+		{0, 0, "1"},
+		{0, 1, "010"},
+		{0, 2, "011"},
+		{0, 3, "00100"},
+		{0, 8, "0001001"},
+		{1, 0, "10"},
+		{1, 1, "11"},
+		{1, 2, "0100"},
+		{1, 5, "0111"},
+		{3, 7, "1111"},
+		{3, 8, "010000"},
+		{0, math.MaxUint64 - 1, strings.Repeat("0", 63) + strings.Repeat("1", 64)},
+		{63, 1<<63 - 1, "1" + strings.Repeat("1", 63)},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, nil)
+		if err := w.WriteExpGolomb(test.k, test.v); err != nil {
+			t.Errorf("WriteExpGolomb(%d, %d): unexpected error: %v", test.k, test.v, err)
+			continue
+		}
+		if got := w.Offset(); got != int64(len(test.want)) {
+			t.Errorf("WriteExpGolomb(%d, %d): wrote %d bits, want %d", test.k, test.v, got, len(test.want))
+		}
+		w.Flush()
+		if got := bitutil.BitString(buf.Bytes())[:len(test.want)]; got != test.want {
+			t.Errorf("WriteExpGolomb(%d, %d): got %s, want %s", test.k, test.v, got, test.want)
+		}
+
+		r := NewReader(&buf, nil)
+		if got, err := r.ReadExpGolomb(test.k); err != nil || got != test.v {
+			t.Errorf("ReadExpGolomb(%d): got %d, %v; want %d, nil", test.k, got, err, test.v)
+		}
+	}
+
+	// Round-trip a sequence of signed and unsigned values.
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	for i := int64(-300); i <= 300; i++ {
+		w.WriteExpGolomb(int(i&3), uint64(i*i))
+		w.WriteSignedExpGolomb(int(i&1), i)
+	}
+	w.WriteSignedExpGolomb(0, math.MaxInt64)
+	w.WriteSignedExpGolomb(0, math.MinInt64+1)
+	w.Flush()
+	r := NewReader(&buf, nil)
+	for i := int64(-300); i <= 300; i++ {
+		if got, err := r.ReadExpGolomb(int(i & 3)); err != nil || got != uint64(i*i) {
+			t.Errorf("ReadExpGolomb: got %d, %v; want %d, nil", got, err, i*i)
+		}
+		if got, err := r.ReadSignedExpGolomb(int(i & 1)); err != nil || got != i {
+			t.Errorf("ReadSignedExpGolomb: got %d, %v; want %d, nil", got, err, i)
+		}
+	}
+	if got, err := r.ReadSignedExpGolomb(0); err != nil || got != math.MaxInt64 {
+		t.Errorf("ReadSignedExpGolomb: got %d, %v; want max, nil", got, err)
+	}
+	if got, err := r.ReadSignedExpGolomb(0); err != nil || got != math.MinInt64+1 {
+		t.Errorf("ReadSignedExpGolomb: got %d, %v; want min+1, nil", got, err)
+	}
+	if _, err := r.ReadExpGolomb(0); err != io.EOF {
+		t.Errorf("ReadExpGolomb at end: got %v, want EOF", err)
+	}
+
+	// Values and codes that are too large are rejected.
+	w = NewWriter(io.Discard, nil)
+	if err := w.WriteExpGolomb(0, math.MaxUint64); !errors.Is(err, ErrCodeLength) {
+		t.Errorf("WriteExpGolomb(max): got %v, want %v", err, ErrCodeLength)
+	}
+	if err := w.WriteSignedExpGolomb(0, math.MinInt64); !errors.Is(err, ErrCodeLength) {
+		t.Errorf("WriteSignedExpGolomb(min): got %v, want %v", err, ErrCodeLength)
+	}
+	if err := w.WriteExpGolomb(64, 0); !errors.Is(err, ErrCountRange) {
+		t.Errorf("WriteExpGolomb(64, 0): got %v, want %v", err, ErrCountRange)
+	}
+	r = NewReader(bytes.NewReader(make([]byte, 20)), nil)
+	if _, err := r.ReadExpGolomb(0); !errors.Is(err, ErrCodeLength) {
+		t.Errorf("ReadExpGolomb(zeros): got %v, want %v", err, ErrCodeLength)
+	}
+	r = NewReader(strings.NewReader("\x00\x00\x01"), nil)
+	if _, err := r.ReadExpGolomb(60); !errors.Is(err, ErrCodeLength) {
+		t.Errorf("ReadExpGolomb(60): got %v, want %v", err, ErrCodeLength)
+	}
+
+	// Truncated codes are reported.
+	for _, input := range []string{"\x00", "\x00\x01"} {
+		r = NewReader(strings.NewReader(input), nil)
+		if _, err := r.ReadExpGolomb(0); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("ReadExpGolomb(%q): got %v, want %v", input, err, io.ErrUnexpectedEOF)
+		}
+	}
+
+	// A code that fits in one field is not partly written when the underlying
+	// writer fails.
+	w = NewWriter(errWriter("bogus"), nil)
+	w.WriteBits(40, 0)
+	if err := w.WriteExpGolomb(0, 1<<20); err == nil {
+		t.Error("WriteExpGolomb(1<<20): got nil, want error")
+	}
+	if got := w.Offset(); got != 40 {
+		t.Errorf("WriteExpGolomb(1<<20) failed: offset is %d, want 40", got)
+	}
+}
+
+func TestUnary(t *testing.T) {
+	// Check the encodings of some specific runs.
+	tests := []struct {
+		bit  bool
+		n    int
+		want string // bits
+	}{
+		{false, 0, "1"},
+		{false, 3, "0001"},
+		{true, 0, "0"},
+		{true, 5, "111110"},
+		{false, 64, strings.Repeat("0", 64) + "1"},
+		{true, 100, strings.Repeat("1", 100) + "0"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, nil)
+		if err := w.WriteUnary(test.bit, test.n); err != nil {
+			t.Errorf("WriteUnary(%v, %d): unexpected error: %v", test.bit, test.n, err)
+			continue
+		}
+		if got := w.Offset(); got != int64(len(test.want)) {
+			t.Errorf("WriteUnary(%v, %d): wrote %d bits, want %d", test.bit, test.n, got, len(test.want))
+		}
+		w.Flush()
+		if got := bitutil.BitString(buf.Bytes())[:len(test.want)]; got != test.want {
+			t.Errorf("WriteUnary(%v, %d): got %s, want %s", test.bit, test.n, got, test.want)
+		}
+
+		r := NewReader(bytes.NewReader(buf.Bytes()), nil)
+		if got, err := r.ReadUnary(test.bit, test.n); err != nil || got != test.n {
+			t.Errorf("ReadUnary(%v, %d): got %d, %v; want %d, nil", test.bit, test.n, got, err, test.n)
+		}
+		if got := r.Offset(); got != int64(len(test.want)) {
+			t.Errorf("ReadUnary(%v, %d): consumed %d bits, want %d", test.bit, test.n, got, len(test.want))
+		}
+
+		// A run longer than the maximum is rejected.
+		if test.n > 0 {
+			r := NewReader(bytes.NewReader(buf.Bytes()), nil)
+			if _, err := r.ReadUnary(test.bit, test.n-1); !errors.Is(err, ErrCodeLength) {
+				t.Errorf("ReadUnary(%v, %d): got %v, want %v", test.bit, test.n-1, err, ErrCodeLength)
+			}
+		}
+	}
+
+	// Runs that reach the end of the stream are truncated.
+	r := NewReader(strings.NewReader("\xff\xff"), nil)
+	if _, err := r.ReadUnary(true, 100); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadUnary(ones): got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := r.ReadUnary(true, 100); err != io.EOF {
+		t.Errorf("ReadUnary at end: got %v, want EOF", err)
+	}
+
+	// Negative lengths are rejected.
+	if _, err := r.ReadUnary(false, -1); !errors.Is(err, ErrCountRange) {
+		t.Errorf("ReadUnary(-1): got %v, want %v", err, ErrCountRange)
+	}
+	if err := NewWriter(io.Discard, nil).WriteUnary(false, -1); !errors.Is(err, ErrCountRange) {
+		t.Errorf("WriteUnary(-1): got %v, want %v", err, ErrCountRange)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	// Check the encodings of some specific values.
+	tests := []struct {
+		n, v uint64
+		want string // bits
+	}{
+		{1, 0, ""},
+		{2, 1, "1"},
+		{5, 0, "00"},
+		{5, 2, "10"},
+		{5, 3, "110"},
+		{5, 4, "111"},
+		{10, 5, "101"},
+		{10, 6, "1100"},
+		{10, 9, "1111"},
+		{16, 9, "1001"},
+		{math.MaxUint64, 0, strings.Repeat("0", 63)},
+		{math.MaxUint64, math.MaxUint64 - 1, strings.Repeat("1", 64)},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, nil)
+		if err := w.WriteTruncated(test.n, test.v); err != nil {
+			t.Errorf("WriteTruncated(%d, %d): unexpected error: %v", test.n, test.v, err)
+			continue
+		}
+		if got := w.Offset(); got != int64(len(test.want)) {
+			t.Errorf("WriteTruncated(%d, %d): wrote %d bits, want %d", test.n, test.v, got, len(test.want))
+		}
+		w.Flush()
+		if got := bitutil.BitString(buf.Bytes())[:len(test.want)]; got != test.want {
+			t.Errorf("WriteTruncated(%d, %d): got %s, want %s", test.n, test.v, got, test.want)
+		}
+
+		r := NewReader(&buf, nil)
+		if got, err := r.ReadTruncated(test.n); err != nil || got != test.v {
+			t.Errorf("ReadTruncated(%d): got %d, %v; want %d, nil", test.n, got, err, test.v)
+		}
+	}
+
+	// Round-trip every value for a range of alphabet sizes.
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	for n := uint64(1); n <= 40; n++ {
+		for v := uint64(0); v < n; v++ {
+			w.WriteTruncated(n, v)
+		}
+	}
+	w.Flush()
+	r := NewReader(&buf, nil)
+	for n := uint64(1); n <= 40; n++ {
+		for v := uint64(0); v < n; v++ {
+			if got, err := r.ReadTruncated(n); err != nil || got != v {
+				t.Errorf("ReadTruncated(%d): got %d, %v; want %d, nil", n, got, err, v)
+			}
+		}
+	}
+
+	// Values outside the alphabet and empty alphabets are rejected.
+	w = NewWriter(io.Discard, nil)
+	if err := w.WriteTruncated(5, 5); !errors.Is(err, ErrCodeLength) {
+		t.Errorf("WriteTruncated(5, 5): got %v, want %v", err, ErrCodeLength)
+	}
+	if err := w.WriteTruncated(0, 0); !errors.Is(err, ErrCountRange) {
+		t.Errorf("WriteTruncated(0, 0): got %v, want %v", err, ErrCountRange)
+	}
+	if _, err := r.ReadTruncated(0); !errors.Is(err, ErrCountRange) {
+		t.Errorf("ReadTruncated(0): got %v, want %v", err, ErrCountRange)
+	}
+
+	// Truncated codes are reported.
+	r = NewReader(strings.NewReader("\xff"), nil)
+	if _, err := r.ReadTruncated(1 << 10); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadTruncated(short): got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestFieldOrder(t *testing.T) {
+	// With both options set, the stream is a little-endian integer, and each
+	// field is the next slice of its bits.
+	input := []byte("\x8d\x3c\xf1\x52\x07\xe8\x99\x40")
+	x := binary.LittleEndian.Uint64(input)
+	widths := []int{3, 5, 1, 7, 13, 2, 9, 24}
+	opts := &Options{LowBitFirst: true, FieldLowBitFirst: true}
+
+	r := NewReader(bytes.NewReader(input), opts)
+	var pos int
+	for _, n := range widths {
+		want := x >> pos & (1<<n - 1)
+		var got uint64
+		if _, err := r.PeekBits(n, &got); err != nil || got != want {
+			t.Errorf("PeekBits(%d) at %d: got %#x, %v; want %#x, nil", n, pos, got, err, want)
+		}
+		if _, err := r.ReadBits(n, &got); err != nil || got != want {
+			t.Errorf("ReadBits(%d) at %d: got %#x, %v; want %#x, nil", n, pos, got, err, want)
+		}
+		pos += n
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, opts)
+	pos = 0
+	for _, n := range widths {
+		w.WriteBits(n, x>>pos)
+		pos += n
+	}
+	w.Flush()
+	if got := buf.Bytes(); !bytes.Equal(got, input) {
+		t.Errorf("WriteBits: got %#x, want %#x", got, input)
+	}
+
+	// Without LowBitFirst, a field is reversed relative to the default order.
+	r = NewReader(strings.NewReader("\xc0"), &Options{FieldLowBitFirst: true})
+	var v uint64
+	if _, err := r.ReadBits(3, &v); err != nil || v != 3 {
+		t.Errorf("ReadBits(3): got %d, %v; want 3, nil", v, err)
+	}
+	if n, err := r.ReadBits(6, &v); err != io.EOF || n != 5 || v != 0 {
+		t.Errorf("ReadBits(6): got %d, %d, %v; want 5, 0, EOF", n, v, err)
+	}
+
+	// Bytes are 8-bit fields, so after aligning the input is recovered.
+	r = NewReader(bytes.NewReader(input), opts)
+	r.ReadBits(5, nil)
+	r.Align(false)
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, input[1:]) {
+		t.Errorf("ReadAll: got %#x, %v; want %#x, nil", got, err, input[1:])
+	}
+	buf.Reset()
+	w = NewWriter(&buf, opts)
+	w.WriteBits(3, 5)
+	w.Align(false)
+	w.Write(input)
+	w.Flush()
+	if got := buf.Bytes(); got[0] != 5 || !bytes.Equal(got[1:], input) {
+		t.Errorf("Write: got %#x, want 05%x", got, input)
+	}
+
+	// Wide fields start with their low-order chunk.
+	wide := []byte("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c")
+	le := slices.Clone(wide)
+	slices.Reverse(le)
+	r = NewReader(bytes.NewReader(le), opts)
+	got := make([]byte, len(wide))
+	if _, err := r.ReadWide(96, got); err != nil || !bytes.Equal(got, wide) {
+		t.Errorf("ReadWide: got %#x, %v; want %#x, nil", got, err, wide)
+	}
+	buf.Reset()
+	w = NewWriter(&buf, opts)
+	w.WriteWide(96, wide)
+	w.Flush()
+	if got := buf.Bytes(); !bytes.Equal(got, le) {
+		t.Errorf("WriteWide: got %#x, want %#x", got, le)
+	}
+	r = NewReader(bytes.NewReader(le), opts)
+	var u128 [2]uint64
+	if _, err := r.ReadUint128(96, &u128); err != nil || u128 != [2]uint64{0x01020304, 0x05060708090a0b0c} {
+		t.Errorf("ReadUint128: got %#x, %v", u128, err)
+	}
+	buf.Reset()
+	w = NewWriter(&buf, opts)
+	w.WriteUint128(96, [2]uint64{0x01020304, 0x05060708090a0b0c})
+	w.Flush()
+	if got := buf.Bytes(); !bytes.Equal(got, le) {
+		t.Errorf("WriteUint128: got %#x, want %#x", got, le)
+	}
+
+	// Variable-length codes are not affected.
+	for _, opt := range []*Options{nil, {FieldLowBitFirst: true}} {
+		buf.Reset()
+		w := NewWriter(&buf, opt)
+		w.WriteExpGolomb(0, 8)
+		w.WriteUnary(true, 3)
+		w.WriteTruncated(5, 3)
+		w.Flush()
+		if got, want := bitutil.BitString(buf.Bytes()), "0001001"+"1110"+"110"+"00"; got != want {
+			t.Errorf("Codes %+v: got %s, want %s", opt, got, want)
+		}
+	}
+}
+
+func TestBackward(t *testing.T) {
+	// A Zstandard-style stream: the fields 5 (3 bits) and 9 (4 bits) written
+	// as a little-endian integer, followed by the sentinel.
+	//
+	//	sentinel 1001 101 == 1100 1101 == 0xCD
+	zstd := &Options{LowBitFirst: true, FieldLowBitFirst: true}
+	tests := []struct {
+		input string
+		opts  *Options
+	}{
+		{"\xcd", zstd},
+		{"\xb3", nil}, // 101 1001 sentinel
+	}
+	for _, test := range tests {
+		r, err := NewBackwardReader([]byte(test.input), test.opts)
+		if err != nil {
+			t.Fatalf("NewBackwardReader %+v: unexpected error: %v", test.opts, err)
+		}
+		if got := r.Offset(); got != 7 {
+			t.Errorf("Offset %+v: got %d, want 7", test.opts, got)
+		}
+		var v uint64
+		if _, err := r.PeekBits(4, &v); err != nil || v != 9 {
+			t.Errorf("PeekBits(4) %+v: got %d, %v; want 9, nil", test.opts, v, err)
+		}
+		if _, err := r.ReadBits(4, &v); err != nil || v != 9 {
+			t.Errorf("ReadBits(4) %+v: got %d, %v; want 9, nil", test.opts, v, err)
+		}
+		if n, err := r.ReadBits(5, &v); err != io.EOF || n != 3 || v != 5 {
+			t.Errorf("ReadBits(5) %+v: got %d, %d, %v; want 3, 5, EOF", test.opts, n, v, err)
+		}
+		if bit, err := r.ReadBit(); err != io.EOF || bit {
+			t.Errorf("ReadBit %+v: got %v, %v; want false, EOF", test.opts, bit, err)
+		}
+	}
+
+	// Fields written forward, with a stop bit as padding, are read in reverse.
+	widths := []int{1, 64, 7, 0, 13, 33, 8, 64, 2, 17, 5, 63, 9, 31, 4}
+	for _, base := range []*Options{{}, {LowBitFirst: true}, zstd, {FieldLowBitFirst: true}} {
+		opts := *base
+		opts.Padding = PadStopBit
+		opts.BufferSize = 8 // exercise reading in blocks
+
+		var buf bytes.Buffer
+		w := NewWriter(&buf, &opts)
+		values := make([]uint64, len(widths))
+		for i, n := range widths {
+			values[i] = 0x9e3779b97f4a7c15 * uint64(i+1) >> (64 - n)
+			w.WriteBits(n, values[i])
+		}
+		w.Flush()
+		size := int64(buf.Len())
+
+		r, err := NewBackwardReaderAt(bytes.NewReader(buf.Bytes()), size, &opts)
+		if err != nil {
+			t.Fatalf("NewBackwardReaderAt %+v: unexpected error: %v", base, err)
+		}
+		for i := len(widths) - 1; i >= 0; i-- {
+			var v uint64
+			if _, err := r.ReadBits(widths[i], &v); err != nil || v != values[i] {
+				t.Errorf("ReadBits(%d) %+v: got %#x, %v; want %#x, nil", widths[i], base, v, err, values[i])
+			}
+		}
+		if r.Offset() != 0 {
+			t.Errorf("Offset %+v: got %d, want 0", base, r.Offset())
+		}
+
+		// Skipping moves by the same amount as reading.
+		r, _ = NewBackwardReaderAt(bytes.NewReader(buf.Bytes()), size, &opts)
+		if n, err := r.SkipBits(4 + 31); err != nil || n != 35 {
+			t.Errorf("SkipBits: got %d, %v; want 35, nil", n, err)
+		}
+		var v uint64
+		if _, err := r.ReadBits(9, &v); err != nil || v != values[len(widths)-3] {
+			t.Errorf("ReadBits after skip %+v: got %#x, %v; want %#x, nil", base, v, err, values[len(widths)-3])
+		}
+	}
+
+	// Errors.
+	for _, input := range []string{"", "\x01\x00"} {
+		if _, err := NewBackwardReader([]byte(input), nil); !errors.Is(err, ErrNoSentinel) {
+			t.Errorf("NewBackwardReader(%q): got %v, want %v", input, err, ErrNoSentinel)
+		}
+	}
+	if _, err := NewBackwardReaderAt(strings.NewReader("\x01"), 2, nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("NewBackwardReaderAt: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	r, err := NewBackwardReader([]byte("\x01\x01"), nil)
+	if err != nil {
+		t.Fatalf("NewBackwardReader: unexpected error: %v", err)
+	}
+	for _, n := range []int{-1, 65} {
+		if _, err := r.ReadBits(n, nil); !errors.Is(err, ErrCountRange) {
+			t.Errorf("ReadBits(%d): got %v, want %v", n, err, ErrCountRange)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package bitstream
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// ErrCodeLength is reported when a variable-length code is longer than the
+// decoder permits, or a value is too large to be encoded.
+var ErrCodeLength = errors.New("code length out of range")
+
+// ReadExpGolomb reads an unsigned Exp-Golomb code of order k from the reader,
+// and returns the value it encodes.  The order-0 codes are the ue(v) codes of
+// H.264 and H.265.  It is an error if k < 0 or k > 63.
+//
+// Codes whose value does not fit in a uint64 are rejected with ErrCodeLength.
+// If the stream ends before the first bit of a code, ReadExpGolomb returns
+// io.EOF; if it ends partway through a code, it reports io.ErrUnexpectedEOF.
+func (r *Reader) ReadExpGolomb(k int) (uint64, error) {
+	if k < 0 || k > 63 {
+		return 0, offsetError(r.off, ErrCountRange)
+	}
+	z, err := r.ReadUnary(false, 63-k)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	if _, err := r.readBits(z+k, &v); err == io.EOF {
+		return 0, offsetError(r.off, io.ErrUnexpectedEOF) // the prefix was consumed
+	} else if err != nil {
+		return 0, err
+	}
+	return (1<<(z+k) | v) - 1<<k, nil
+}
+
+// WriteExpGolomb appends v to the stream as an unsigned Exp-Golomb code of
+// order k.  It is an error if k < 0 or k > 63.  If v + 2^k does not fit in a
+// uint64, WriteExpGolomb reports ErrCodeLength and nothing is written.
+//
+// Codes of up to 64 bits are written as a single field, so that if an error
+// occurs nothing is written.  Longer codes are written in pieces, and the
+// results follow the same rules as WriteWide.
+func (w *Writer) WriteExpGolomb(k int, v uint64) error {
+	if k < 0 || k > 63 {
+		return offsetError(w.Offset(), ErrCountRange)
+	}
+	x := v + 1<<k
+	if x < v {
+		return offsetError(w.Offset(), ErrCodeLength)
+	}
+
+	// The leading zeroes of the code are the high-order bits of the field.
+	nb := bits.Len64(x)
+	if n := 2*nb - 1 - k; n <= 64 {
+		_, err := w.writeBits(n, x)
+		return err
+	}
+	if _, err := w.writeBits(nb-1-k, 0); err != nil {
+		return err
+	}
+	_, err := w.writeBits(nb, x)
+	return err
+}
+
+// ReadSignedExpGolomb reads a signed Exp-Golomb code of order k from the
+// reader, and returns the value it encodes.  The order-0 codes are the se(v)
+// codes of H.264 and H.265.  Signed values are mapped to unsigned codes as
+// 0, 1, -1, 2, -2, ...  Errors are reported as for ReadExpGolomb.
+func (r *Reader) ReadSignedExpGolomb(k int) (int64, error) {
+	u, err := r.ReadExpGolomb(k)
+	if err != nil {
+		return 0, err
+	}
+	if u&1 != 0 {
+		return int64(u>>1) + 1, nil
+	}
+	return -int64(u >> 1), nil
+}
+
+// WriteSignedExpGolomb appends v to the stream as a signed Exp-Golomb code of
+// order k, using the mapping described for ReadSignedExpGolomb.  Errors are
+// reported as for WriteExpGolomb.
+func (w *Writer) WriteSignedExpGolomb(k int, v int64) error {
+	if v == -1<<63 {
+		return offsetError(w.Offset(), ErrCodeLength)
+	}
+	var u uint64
+	if v > 0 {
+		u = 2*uint64(v) - 1
+	} else {
+		u = 2 * uint64(-v)
+	}
+	return w.WriteExpGolomb(k, u)
+}
+
+// ReadUnary reads a run of bits equal to bit, terminated by a single bit of
+// the opposite value, and returns the length of the run, not counting the
+// terminator.  For example, with bit == false the sequence 0 0 0 1 has length
+// 3.  The stream is examined a word at a time using lookahead, rather than
+// one bit at a time.  With the NoReadAhead option, the lookahead is limited to
+// the bits already buffered, or else the next byte, so that ReadUnary does not
+// block waiting for input beyond the end of the run.  It is an error if
+// max < 0.
+//
+// If the run is longer than max bits, ReadUnary reports ErrCodeLength, and
+// the position of the reader is unspecified.  If the stream ends before the
+// first bit of the run, ReadUnary returns io.EOF; if it ends partway through
+// the run, it reports io.ErrUnexpectedEOF.
+func (r *Reader) ReadUnary(bit bool, max int) (int, error) {
+	if max < 0 {
+		return 0, offsetError(r.off, ErrCountRange)
+	}
+	for n := 0; ; {
+		want := 64
+		if r.opts.noReadAhead() {
+			want = min(int(r.nb)+int(r.nn), 64)
+			if want == 0 {
+				want = 8
+			}
+		}
+		var v uint64
+		nr, err := r.peekBits(want, &v)
+		if err != nil && err != io.EOF {
+			return 0, err
+		} else if nr == 0 {
+			return 0, shortRead(r, n, io.EOF)
+		}
+		if bit {
+			v = ^v
+		}
+		z := min(bits.LeadingZeros64(v<<(64-nr)), nr) // length of the run in v
+		if n+z > max {
+			return 0, offsetError(r.off, ErrCodeLength)
+		} else if z < nr {
+			r.SkipBits(z + 1)
+			return n + z, nil
+		}
+		r.SkipBits(nr)
+		n += nr
+	}
+}
+
+// WriteUnary appends n copies of bit to the stream, followed by a single bit
+// of the opposite value.  It is an error if n < 0.  The results follow the
+// same rules as WriteWide.
+func (w *Writer) WriteUnary(bit bool, n int) error {
+	if n < 0 {
+		return offsetError(w.Offset(), ErrCountRange)
+	}
+	var run uint64
+	if bit {
+		run = ^run
+	}
+	for ; n >= 64; n -= 64 {
+		if _, err := w.writeBits(64, run); err != nil {
+			return err
+		}
+	}
+	// The run and its terminator are the low-order n+1 bits of run^1.
+	_, err := w.writeBits(n+1, (run^1)&(1<<(n+1)-1))
+	return err
+}
+
+// ReadTruncated reads a truncated binary code for an alphabet of size n from
+// the reader, and returns the value it encodes, 0 ≤ v < n.  It is an error if
+// n == 0.  If the stream ends before the code is complete, ReadTruncated
+// reports io.EOF or io.ErrUnexpectedEOF as described for ReadUint.
+//
+// In a truncated binary code with k = ⌈log₂ n⌉, the first 2^k - n values are
+// written in k-1 bits and the rest are written in k bits, offset by 2^k - n.
+func (r *Reader) ReadTruncated(n uint64) (uint64, error) {
+	if n == 0 {
+		return 0, offsetError(r.off, ErrCountRange)
+	}
+	k, u := truncatedSplit(n)
+	if k == 0 {
+		return 0, nil
+	}
+	var v uint64
+	if nr, err := r.readBits(k-1, &v); err != nil {
+		return 0, shortRead(r, nr, err)
+	}
+	if v < u {
+		return v, nil
+	}
+	var lo uint64
+	if nr, err := r.readBits(1, &lo); err != nil {
+		return 0, shortRead(r, nr+k-1, err)
+	}
+	return (v<<1 | lo) - u, nil
+}
+
+// WriteTruncated appends v to the stream as a truncated binary code for an
+// alphabet of size n, as described for ReadTruncated.  It is an error if n ==
+// 0.  If v ≥ n, WriteTruncated reports ErrCodeLength and nothing is written.
+func (w *Writer) WriteTruncated(n, v uint64) error {
+	if n == 0 {
+		return offsetError(w.Offset(), ErrCountRange)
+	} else if v >= n {
+		return offsetError(w.Offset(), ErrCodeLength)
+	}
+	k, u := truncatedSplit(n)
+	var err error
+	if v < u {
+		_, err = w.writeBits(k-1, v)
+	} else {
+		_, err = w.writeBits(k, v+u)
+	}
+	return err
+}
+
+// truncatedSplit returns the length k of the longest truncated binary code
+// for an alphabet of size n > 0, and the number u of values whose codes are
+// one bit shorter.
+func truncatedSplit(n uint64) (k int, u uint64) {
+	k = bits.Len64(n - 1)
+	return k, 1<<k - n
+}
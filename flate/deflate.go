@@ -0,0 +1,438 @@
+package flate
+
+import (
+	"io"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/huffman"
+)
+
+// A Writer compresses data written to it as a DEFLATE stream.  Data are
+// buffered until a full block is available, so the caller must call Close
+// when finished to write the final block.
+type Writer struct {
+	bw   *bitstream.Writer
+	opts *Options
+	err  error // if non-nil, the error to report for further writes
+
+	// The input is accumulated in hist, of which the first nhist bytes are
+	// history retained from previous blocks, for matches to refer to.
+	hist  []byte
+	nhist int
+
+	head []int32 // for each hash, the last position in hist with that hash
+	prev []int32 // for each position in hist, the previous with its hash
+}
+
+// NewWriter returns a Writer that writes compressed data to w.
+func NewWriter(w io.Writer, opts *Options) *Writer {
+	size := windowSize + opts.blockSize()
+	return &Writer{
+		bw:   bitstream.NewWriter(w, bitOptions()),
+		opts: opts,
+		hist: make([]byte, 0, size),
+		head: make([]int32, 1<<hashBits),
+		prev: make([]int32, size),
+	}
+}
+
+// Write implements the io.Writer interface.  It reports the number of bytes
+// of data accepted for compression.
+func (w *Writer) Write(data []byte) (int, error) {
+	var nw int
+	for w.err == nil && nw < len(data) {
+		// Write out a full block only when more data arrive, so that Close can
+		// mark the last block as final.
+		if len(w.hist)-w.nhist == w.opts.blockSize() {
+			if err := w.writeBlock(false); err != nil {
+				w.err = err
+				break
+			}
+		}
+		n := min(len(data)-nw, w.nhist+w.opts.blockSize()-len(w.hist))
+		w.hist = append(w.hist, data[nw:nw+n]...)
+		nw += n
+	}
+	return nw, w.err
+}
+
+// Offset returns the number of bits of compressed data written so far.
+func (w *Writer) Offset() int64 { return w.bw.Offset() }
+
+// Close writes any remaining data as the final block of the stream, and
+// flushes the output.  It does not close the underlying writer.  After Close
+// succeeds, further writes report ErrClosed.
+func (w *Writer) Close() error {
+	if w.err == ErrClosed {
+		return nil
+	} else if w.err != nil {
+		return w.err
+	}
+	if err := w.writeBlock(true); err != nil {
+		w.err = err
+		return err
+	}
+	if err := w.bw.Flush(); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = ErrClosed
+	return nil
+}
+
+// writeBlock compresses and writes the pending input as a single block, and
+// retains the end of the input as history.
+func (w *Writer) writeBlock(final bool) error {
+	data := w.hist[w.nhist:]
+	block := Block{Final: final, Start: w.bw.Offset(), Size: int64(len(data))}
+	tokens := w.tokens()
+
+	// Count the symbols used, and construct a code fitted to them.
+	var litFreq [numLitLen]uint64
+	var distFreq [numDist]uint64
+	for _, t := range tokens {
+		if t.dist == 0 {
+			litFreq[t.value]++
+		} else {
+			litFreq[endOfBlock+1+int(lengthSym[t.value])]++
+			distFreq[distSym(int(t.dist))]++
+		}
+	}
+	litFreq[endOfBlock] = 1
+	hdr := newDynamicHeader(litFreq[:], distFreq[:])
+
+	// Choose the encoding of the block.  The cost of each, in bits, includes
+	// the 3-bit block header.
+	block.Type = w.opts.blockType()
+	if block.Type == Auto {
+		pad := int(8-(w.bw.Offset()+3)%8) % 8
+		fixedCost := 3 + dataCost(litFreq[:], distFreq[:], fixedLit, fixedDist)
+		dynamicCost := 3 + hdr.cost() + dataCost(litFreq[:], distFreq[:], hdr.lit, hdr.dist)
+		storedCost := 3 + pad + 32 + 8*len(data)
+
+		best := fixedCost
+		block.Type = Fixed
+		if dynamicCost < best {
+			block.Type, best = Dynamic, dynamicCost
+		}
+		if storedCost < best {
+			block.Type = Stored
+		}
+	}
+
+	var final1 uint64
+	if final {
+		final1 = 1
+	}
+	if _, err := w.bw.WriteBits(1, final1); err != nil {
+		return err
+	}
+	var err error
+	switch block.Type {
+	case Stored:
+		err = w.writeStored(data)
+	case Fixed:
+		if _, err = w.bw.WriteBits(2, 1); err == nil {
+			err = w.writeTokens(tokens, fixedLit, fixedDist)
+		}
+	default:
+		if _, err = w.bw.WriteBits(2, 2); err == nil {
+			if err = hdr.write(w.bw); err == nil {
+				err = w.writeTokens(tokens, hdr.lit, hdr.dist)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	block.End = w.bw.Offset()
+	w.opts.onBlock(block)
+
+	// Retain the end of the input as history for the next block.
+	keep := min(len(w.hist), windowSize)
+	n := copy(w.hist, w.hist[len(w.hist)-keep:])
+	w.hist, w.nhist = w.hist[:n], n
+	return nil
+}
+
+// writeStored writes the rest of a stored block containing data, following
+// the BFINAL bit.
+func (w *Writer) writeStored(data []byte) error {
+	if _, err := w.bw.WriteBits(2, 0); err != nil {
+		return err
+	}
+	if _, err := w.bw.Align(false); err != nil {
+		return err
+	}
+	if _, err := w.bw.WriteBits(16, uint64(len(data))); err != nil {
+		return err
+	}
+	if _, err := w.bw.WriteBits(16, uint64(len(data))^0xffff); err != nil {
+		return err
+	}
+	_, err := w.bw.Write(data)
+	return err
+}
+
+// writeTokens writes tokens using the given codes, followed by the end of
+// block symbol.
+func (w *Writer) writeTokens(tokens []token, lit, dist *huffman.Code) error {
+	for _, t := range tokens {
+		if t.dist == 0 {
+			if err := lit.Encode(w.bw, int(t.value)); err != nil {
+				return err
+			}
+			continue
+		}
+		ls := int(lengthSym[t.value])
+		if err := lit.Encode(w.bw, endOfBlock+1+ls); err != nil {
+			return err
+		}
+		if _, err := w.bw.WriteBits(lengthExtra[ls], uint64(int(t.value)-lengthBase[ls])); err != nil {
+			return err
+		}
+		ds := distSym(int(t.dist))
+		if err := dist.Encode(w.bw, ds); err != nil {
+			return err
+		}
+		if _, err := w.bw.WriteBits(distExtra[ds], uint64(int(t.dist)-distBase[ds])); err != nil {
+			return err
+		}
+	}
+	return lit.Encode(w.bw, endOfBlock)
+}
+
+// dataCost returns the number of bits needed to encode symbols with the given
+// frequencies, including extra bits, using the given codes.
+func dataCost(litFreq, distFreq []uint64, lit, dist *huffman.Code) int {
+	var sum uint64
+	for sym, f := range litFreq {
+		_, n := lit.Codeword(sym)
+		sum += f * uint64(n)
+		if sym > endOfBlock {
+			sum += f * uint64(lengthExtra[sym-endOfBlock-1])
+		}
+	}
+	for sym, f := range distFreq {
+		_, n := dist.Codeword(sym)
+		sum += f * uint64(n+distExtra[sym])
+	}
+	return int(sum)
+}
+
+// A token is a literal byte (dist == 0), or a match of the given length
+// (value) and distance.
+type token struct {
+	value uint16
+	dist  uint16
+}
+
+const (
+	hashBits = 15  // the number of bits in the hash of a 3-byte sequence
+	maxChain = 128 // the maximum number of earlier positions tried per match
+)
+
+// hash returns the hash of the 3 bytes at the start of b.
+func hash(b []byte) uint32 {
+	v := uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	return v * 2654435761 >> (32 - hashBits)
+}
+
+// tokens divides the pending input into literals and matches, using a greedy
+// LZ77 search.  Earlier positions with the same 3-byte hash are kept in
+// chains, which are searched from the most recent for the longest match.
+func (w *Writer) tokens() []token {
+	for i := range w.head {
+		w.head[i] = -1
+	}
+	insert := func(i int) {
+		if i+minMatch <= len(w.hist) {
+			h := hash(w.hist[i:])
+			w.prev[i] = w.head[h]
+			w.head[h] = int32(i)
+		}
+	}
+	for i := 0; i < w.nhist; i++ {
+		insert(i)
+	}
+
+	var tokens []token
+	for i := w.nhist; i < len(w.hist); {
+		var bestLen, bestDist int
+		if limit := min(maxMatch, len(w.hist)-i); limit >= minMatch {
+			cur := w.hist[i : i+limit]
+			j := w.head[hash(cur)]
+			for n := 0; j >= 0 && i-int(j) <= windowSize && n < maxChain; n++ {
+				m := matchLength(w.hist[j:], cur)
+				if m > bestLen {
+					bestLen, bestDist = m, i-int(j)
+					if m == limit {
+						break
+					}
+				}
+				j = w.prev[j]
+			}
+		}
+		if bestLen < minMatch {
+			tokens = append(tokens, token{value: uint16(w.hist[i])})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, token{value: uint16(bestLen), dist: uint16(bestDist)})
+		for end := i + bestLen; i < end; i++ {
+			insert(i)
+		}
+	}
+	return tokens
+}
+
+// matchLength returns the length of the common prefix of a and b.
+func matchLength(a, b []byte) int {
+	for i := range b {
+		if i >= len(a) || a[i] != b[i] {
+			return i
+		}
+	}
+	return len(b)
+}
+
+// A dynamicHeader holds the codes for a dynamic block, and the encoding of
+// their lengths in the block header.
+type dynamicHeader struct {
+	lit, dist   *huffman.Code
+	nlit, ndist int           // the number of code lengths sent for each code
+	clc         *huffman.Code // the code length code
+	nclen       int           // the number of code length code lengths sent
+	lengths     []clToken     // the code lengths, run-length encoded
+}
+
+// A clToken is a symbol of the code length code, and the value of its extra
+// bits, if any.
+type clToken struct {
+	sym, extra uint8
+}
+
+// clExtra is the number of extra bits following each repeat symbol of the
+// code length code.
+var clExtra = [...]int{16: 2, 17: 3, 18: 7}
+
+// newDynamicHeader constructs the codes and header for a dynamic block with
+// the given symbol frequencies.
+func newDynamicHeader(litFreq, distFreq []uint64) *dynamicHeader {
+	h := new(dynamicHeader)
+	litLens, _ := huffman.Lengths(litFreq, 15)
+
+	// There must be at least one distance code, even if it is not used.
+	if distFreq = append([]uint64(nil), distFreq...); allZero(distFreq) {
+		distFreq[0] = 1
+	}
+	distLens, _ := huffman.Lengths(distFreq, 15)
+	h.lit, _ = huffman.FromLengths(litLens)
+	h.dist, _ = huffman.FromLengths(distLens)
+
+	// Trailing unused symbols need not be sent.
+	h.nlit, h.ndist = len(litLens), len(distLens)
+	for h.nlit > 257 && litLens[h.nlit-1] == 0 {
+		h.nlit--
+	}
+	for h.ndist > 1 && distLens[h.ndist-1] == 0 {
+		h.ndist--
+	}
+	all := append(litLens[:h.nlit:h.nlit], distLens[:h.ndist]...)
+	h.lengths = runLengths(all)
+
+	var clFreq [len(clOrder)]uint64
+	for _, t := range h.lengths {
+		clFreq[t.sym]++
+	}
+	clLens, _ := huffman.Lengths(clFreq[:], 7)
+	h.clc, _ = huffman.FromLengths(clLens)
+	h.nclen = len(clOrder)
+	for h.nclen > 4 && clLens[clOrder[h.nclen-1]] == 0 {
+		h.nclen--
+	}
+	return h
+}
+
+// cost returns the number of bits in the encoding of h, excluding the 3-bit
+// block header.
+func (h *dynamicHeader) cost() int {
+	n := 5 + 5 + 4 + 3*h.nclen
+	for _, t := range h.lengths {
+		_, nc := h.clc.Codeword(int(t.sym))
+		n += nc + clExtra[t.sym]
+	}
+	return n
+}
+
+// write writes the encoding of h to bw.
+func (h *dynamicHeader) write(bw *bitstream.Writer) error {
+	if _, err := bw.WriteBits(5, uint64(h.nlit-257)); err != nil {
+		return err
+	}
+	if _, err := bw.WriteBits(5, uint64(h.ndist-1)); err != nil {
+		return err
+	}
+	if _, err := bw.WriteBits(4, uint64(h.nclen-4)); err != nil {
+		return err
+	}
+	for _, sym := range clOrder[:h.nclen] {
+		_, n := h.clc.Codeword(sym)
+		if _, err := bw.WriteBits(3, uint64(n)); err != nil {
+			return err
+		}
+	}
+	for _, t := range h.lengths {
+		if err := h.clc.Encode(bw, int(t.sym)); err != nil {
+			return err
+		}
+		if _, err := bw.WriteBits(clExtra[t.sym], uint64(t.extra)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runLengths returns the run-length encoding of a sequence of code lengths,
+// as described in RFC 1951 section 3.2.7.
+func runLengths(lengths []int) []clToken {
+	var out []clToken
+	for i := 0; i < len(lengths); {
+		v, n := lengths[i], 1
+		for i+n < len(lengths) && lengths[i+n] == v {
+			n++
+		}
+		i += n
+
+		if v == 0 {
+			// Runs of zeroes: 18 repeats 11-138 times, 17 repeats 3-10 times.
+			for ; n >= 11; n -= min(n, 138) {
+				out = append(out, clToken{sym: 18, extra: uint8(min(n, 138) - 11)})
+			}
+			if n >= 3 {
+				out = append(out, clToken{sym: 17, extra: uint8(n - 3)})
+				n = 0
+			}
+		} else {
+			// Other runs: 16 repeats the previous length 3-6 times.
+			out = append(out, clToken{sym: uint8(v)})
+			for n--; n >= 3; n -= min(n, 6) {
+				out = append(out, clToken{sym: 16, extra: uint8(min(n, 6) - 3)})
+			}
+		}
+		for ; n > 0; n-- {
+			out = append(out, clToken{sym: uint8(v)})
+		}
+	}
+	return out
+}
+
+func allZero(vs []uint64) bool {
+	for _, v := range vs {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+// Package flate implements the DEFLATE compressed data format described in
+// RFC 1951, over bit streams.
+//
+// This implementation is meant to be easy to read and to inspect, rather than
+// fast.  The bits of a DEFLATE stream are packed into bytes starting from the
+// least-significant bit, and fields other than Huffman codes are stored
+// starting from their least-significant bit, so the Reader and Writer use a
+// bitstream with both the LowBitFirst and FieldLowBitFirst options set.
+// Huffman codes are handled by the huffman package.
+//
+// The output of a Writer can be decompressed by the standard compress/flate
+// package, and a Reader can decompress the output of compress/flate.  Both
+// can report the boundaries of each block they process, as bit offsets in
+// the compressed stream, via the OnBlock option.
+package flate
+
+import (
+	"errors"
+	"math/bits"
+	"strconv"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/huffman"
+)
+
+// ErrCorrupt is reported when the compressed input is not a valid DEFLATE
+// stream.  Errors reporting corrupt input wrap ErrCorrupt in a
+// *bitstream.OffsetError giving the bit offset of the problem.
+var ErrCorrupt = errors.New("flate: corrupt input")
+
+// ErrClosed is reported when writing to a Writer that has been closed.
+var ErrClosed = errors.New("flate: writer is closed")
+
+// MaxBlockSize is the largest number of uncompressed bytes a Writer puts in a
+// single block.  This is the capacity of a stored block.
+const MaxBlockSize = 1<<16 - 1
+
+// A BlockType identifies the encoding of a DEFLATE block.
+type BlockType int
+
+const (
+	// Auto instructs a Writer to choose whichever encoding makes each block
+	// smallest.  It is not the type of any block.
+	Auto BlockType = iota
+
+	// Stored is a block of uncompressed data (BTYPE 00).
+	Stored
+
+	// Fixed is a block compressed with the fixed Huffman codes (BTYPE 01).
+	Fixed
+
+	// Dynamic is a block compressed with Huffman codes given in the block
+	// header (BTYPE 10).
+	Dynamic
+)
+
+// String returns the name of the block type.
+func (t BlockType) String() string {
+	switch t {
+	case Auto:
+		return "Auto"
+	case Stored:
+		return "Stored"
+	case Fixed:
+		return "Fixed"
+	case Dynamic:
+		return "Dynamic"
+	default:
+		return "BlockType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// A Block describes a block of a DEFLATE stream.
+type Block struct {
+	Type  BlockType // the encoding of the block
+	Final bool      // whether this is the last block of the stream
+
+	// The bit offsets in the compressed stream of the first bit of the block
+	// header, and of the bit following the end of the block.  For a stored
+	// block, the end is byte aligned.
+	Start, End int64
+
+	Size int64 // the number of uncompressed bytes in the block
+}
+
+// Options control the behaviour of a Reader or Writer.  A nil *Options is
+// equivalent to a zero-valued Options.
+type Options struct {
+	// The encoding a Writer uses for each block.  If Auto, the Writer chooses
+	// the encoding that gives the smallest block.
+	Type BlockType
+
+	// The maximum number of uncompressed bytes a Writer puts in each block.
+	// Values ≤ 0 or greater than MaxBlockSize are treated as MaxBlockSize.
+	BlockSize int
+
+	// If non-nil, this function is called with a description of each block
+	// after it has been completely read or written.
+	OnBlock func(Block)
+}
+
+func (o *Options) blockType() BlockType {
+	if o == nil {
+		return Auto
+	}
+	return o.Type
+}
+
+func (o *Options) blockSize() int {
+	if o == nil || o.BlockSize <= 0 || o.BlockSize > MaxBlockSize {
+		return MaxBlockSize
+	}
+	return o.BlockSize
+}
+
+func (o *Options) onBlock(b Block) {
+	if o != nil && o.OnBlock != nil {
+		o.OnBlock(b)
+	}
+}
+
+// bitOptions are the options for the underlying bit streams.
+func bitOptions() *bitstream.Options {
+	return &bitstream.Options{LowBitFirst: true, FieldLowBitFirst: true}
+}
+
+const (
+	windowSize = 1 << 15 // the maximum distance of a match
+	minMatch   = 3       // the length of the shortest match
+	maxMatch   = 258     // the length of the longest match
+	endOfBlock = 256     // the literal/length symbol marking the end of a block
+
+	numLitLen = 286 // the number of valid literal/length symbols
+	numDist   = 30  // the number of valid distance symbols
+)
+
+// The base values and extra bit counts of the length symbols 257 to 285.
+var (
+	lengthBase = [...]int{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+		35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258,
+	}
+	lengthExtra = [...]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+		3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0,
+	}
+)
+
+// The base values and extra bit counts of the distance symbols 0 to 29.
+var (
+	distBase = [...]int{
+		1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+		257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145,
+		8193, 12289, 16385, 24577,
+	}
+	distExtra = [...]int{
+		0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+		7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13,
+	}
+)
+
+// lengthSym maps each match length to the index of its length symbol, less
+// 257.
+var lengthSym = func() (t [maxMatch + 1]uint8) {
+	for i := len(lengthBase) - 1; i >= 0; i-- {
+		for n := lengthBase[i]; n <= maxMatch && t[n] == 0; n++ {
+			t[n] = uint8(i)
+		}
+	}
+	return
+}()
+
+// distSym returns the distance symbol for a match distance 1 ≤ d ≤ 32768.
+// Beyond the first four, each pair of symbols covers twice the range of the
+// previous pair, so the symbol is determined by the length of d-1 and the bit
+// following its leading one.
+func distSym(d int) int {
+	x := d - 1
+	if x < 4 {
+		return x
+	}
+	n := bits.Len(uint(x))
+	return 2*(n-1) + x>>(n-2)&1
+}
+
+// clOrder is the order in which the lengths of the code length code are
+// stored in a dynamic block header.
+var clOrder = [...]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// The fixed literal/length and distance codes of RFC 1951 section 3.2.6.  The
+// symbols 286, 287, 30, and 31 participate in the codes but are invalid.
+var fixedLit, fixedDist = func() (*huffman.Code, *huffman.Code) {
+	var lit [288]int
+	for i := range lit {
+		switch {
+		case i < 144:
+			lit[i] = 8
+		case i < 256:
+			lit[i] = 9
+		case i < 280:
+			lit[i] = 7
+		default:
+			lit[i] = 8
+		}
+	}
+	var dist [32]int
+	for i := range dist {
+		dist[i] = 5
+	}
+	lc, err := huffman.FromLengths(lit[:])
+	if err != nil {
+		panic(err)
+	}
+	dc, err := huffman.FromLengths(dist[:])
+	if err != nil {
+		panic(err)
+	}
+	return lc, dc
+}()
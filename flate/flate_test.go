@@ -0,0 +1,264 @@
+package flate_test
+
+import (
+	"bytes"
+	stdflate "compress/flate"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/bitstream/flate"
+)
+
+// testInputs returns a collection of inputs with varied compressibility.
+func testInputs() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	rng.Read(random)
+
+	// Text drawn from a small vocabulary compresses well with matches.
+	words := strings.Fields("the quick brown fox jumps over a lazy dog while bits flow freely")
+	var text bytes.Buffer
+	for text.Len() < 200000 {
+		text.WriteString(words[rng.Intn(len(words))])
+		text.WriteByte(" \n"[rng.Intn(2)])
+	}
+
+	// Skewed bytes compress well with Huffman codes alone.
+	skewed := make([]byte, 70000)
+	for i := range skewed {
+		skewed[i] = byte(rng.ExpFloat64() * 4)
+	}
+	return map[string][]byte{
+		"empty":  nil,
+		"byte":   []byte("x"),
+		"zeroes": make([]byte, 150000),
+		"random": random,
+		"text":   text.Bytes(),
+		"skewed": skewed,
+	}
+}
+
+func TestReadStandard(t *testing.T) {
+	for name, input := range testInputs() {
+		for _, level := range []int{stdflate.NoCompression, stdflate.BestSpeed, stdflate.BestCompression, stdflate.HuffmanOnly} {
+			var buf bytes.Buffer
+			w, err := stdflate.NewWriter(&buf, level)
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			w.Write(input)
+			w.Close()
+
+			got, err := io.ReadAll(flate.NewReader(&buf, nil))
+			if err != nil {
+				t.Errorf("%s level %d: ReadAll: unexpected error: %v", name, level, err)
+			} else if !bytes.Equal(got, input) {
+				t.Errorf("%s level %d: got %d bytes, want %d", name, level, len(got), len(input))
+			}
+		}
+	}
+}
+
+func TestWriteStandard(t *testing.T) {
+	for name, input := range testInputs() {
+		for _, opts := range []*flate.Options{
+			nil,
+			{Type: flate.Stored},
+			{Type: flate.Fixed},
+			{Type: flate.Dynamic, BlockSize: 4000},
+			{BlockSize: 1000},
+		} {
+			var buf bytes.Buffer
+			w := flate.NewWriter(&buf, opts)
+			// Write in uneven pieces, to exercise block boundaries.
+			for rest := input; len(rest) > 0; {
+				n := min(len(rest), 3001)
+				if _, err := w.Write(rest[:n]); err != nil {
+					t.Fatalf("Write: unexpected error: %v", err)
+				}
+				rest = rest[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: unexpected error: %v", err)
+			}
+			compressed := buf.Bytes()
+
+			got, err := io.ReadAll(stdflate.NewReader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Errorf("%s %+v: compress/flate: unexpected error: %v", name, opts, err)
+			} else if !bytes.Equal(got, input) {
+				t.Errorf("%s %+v: compress/flate: got %d bytes, want %d", name, opts, len(got), len(input))
+			}
+			got, err = io.ReadAll(flate.NewReader(bytes.NewReader(compressed), nil))
+			if err != nil {
+				t.Errorf("%s %+v: ReadAll: unexpected error: %v", name, opts, err)
+			} else if !bytes.Equal(got, input) {
+				t.Errorf("%s %+v: ReadAll: got %d bytes, want %d", name, opts, len(got), len(input))
+			}
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	// The automatic choice of block type should compress compressible data,
+	// and not expand incompressible data much.
+	inputs := testInputs()
+	for _, name := range []string{"zeroes", "text", "skewed", "random"} {
+		input := inputs[name]
+		var buf bytes.Buffer
+		w := flate.NewWriter(&buf, nil)
+		w.Write(input)
+		w.Close()
+
+		var std bytes.Buffer
+		sw, _ := stdflate.NewWriter(&std, stdflate.DefaultCompression)
+		sw.Write(input)
+		sw.Close()
+		t.Logf("%s: %d bytes, compressed to %d (compress/flate: %d)", name, len(input), buf.Len(), std.Len())
+		if name == "random" {
+			if buf.Len() > len(input)+len(input)/100 {
+				t.Errorf("%s: compressed %d bytes to %d", name, len(input), buf.Len())
+			}
+		} else if buf.Len() > 2*std.Len() {
+			t.Errorf("%s: compressed %d bytes to %d, compress/flate gives %d", name, len(input), buf.Len(), std.Len())
+		}
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	input := testInputs()["text"]
+	var wblocks, rblocks []flate.Block
+	var buf bytes.Buffer
+	w := flate.NewWriter(&buf, &flate.Options{
+		BlockSize: 50000,
+		OnBlock:   func(b flate.Block) { wblocks = append(wblocks, b) },
+	})
+	w.Write(input[:120000])
+	w.Close()
+
+	r := flate.NewReader(&buf, &flate.Options{
+		OnBlock: func(b flate.Block) { rblocks = append(rblocks, b) },
+	})
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll: unexpected error: %v", err)
+	}
+
+	if len(wblocks) != 3 {
+		t.Fatalf("Writer reported %d blocks, want 3", len(wblocks))
+	}
+	var size, end int64
+	for i, b := range wblocks {
+		if b.Start != end {
+			t.Errorf("Block %d starts at %d, want %d", i, b.Start, end)
+		}
+		if b.Final != (i == len(wblocks)-1) {
+			t.Errorf("Block %d: final is %v", i, b.Final)
+		}
+		if b.Type != flate.Dynamic {
+			t.Errorf("Block %d: type is %v, want %v", i, b.Type, flate.Dynamic)
+		}
+		size += b.Size
+		end = b.End
+	}
+	if size != 120000 {
+		t.Errorf("Total block size is %d, want 120000", size)
+	}
+	if got := r.Offset(); got != end {
+		t.Errorf("Reader offset is %d, want %d", got, end)
+	}
+	if len(rblocks) != len(wblocks) {
+		t.Fatalf("Reader reported %d blocks, want %d", len(rblocks), len(wblocks))
+	}
+	for i := range rblocks {
+		if rblocks[i] != wblocks[i] {
+			t.Errorf("Block %d: Reader reported %+v, Writer reported %+v", i, rblocks[i], wblocks[i])
+		}
+	}
+
+	// Stored blocks end at a byte boundary.
+	buf.Reset()
+	wblocks = nil
+	w = flate.NewWriter(&buf, &flate.Options{
+		Type:    flate.Stored,
+		OnBlock: func(b flate.Block) { wblocks = append(wblocks, b) },
+	})
+	w.Write([]byte("hello"))
+	w.Close()
+	want := flate.Block{Type: flate.Stored, Final: true, Start: 0, End: 8 * 10, Size: 5}
+	if len(wblocks) != 1 || wblocks[0] != want {
+		t.Errorf("Stored blocks: got %+v, want %+v", wblocks, want)
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	// The Reader does not consume input past the end of the stream when the
+	// source is an io.ByteReader.
+	var buf bytes.Buffer
+	w := flate.NewWriter(&buf, nil)
+	w.Write([]byte("some compressed data, some compressed data"))
+	w.Close()
+	buf.WriteString("trailer")
+
+	src := bytes.NewReader(buf.Bytes())
+	if _, err := io.ReadAll(flate.NewReader(src, nil)); err != nil {
+		t.Fatalf("ReadAll: unexpected error: %v", err)
+	}
+	if rest, _ := io.ReadAll(src); string(rest) != "trailer" {
+		t.Errorf("Remaining input: got %q, want %q", rest, "trailer")
+	}
+
+	// The same holds for the output of compress/flate, where the final
+	// end-of-block code may end close to the end of the stream.
+	input := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 32)[:1400]
+	for _, level := range []int{stdflate.BestSpeed, stdflate.DefaultCompression, stdflate.BestCompression, stdflate.HuffmanOnly} {
+		var buf bytes.Buffer
+		sw, _ := stdflate.NewWriter(&buf, level)
+		sw.Write(input)
+		sw.Close()
+		buf.WriteString("TRAILER")
+
+		src := bytes.NewReader(buf.Bytes())
+		if got, err := io.ReadAll(flate.NewReader(src, nil)); err != nil || !bytes.Equal(got, input) {
+			t.Fatalf("Level %d: ReadAll: got %d bytes, %v; want %d, nil", level, len(got), err, len(input))
+		}
+		if rest, _ := io.ReadAll(src); string(rest) != "TRAILER" {
+			t.Errorf("Level %d: remaining input: got %q, want %q", level, rest, "TRAILER")
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"empty", "", io.ErrUnexpectedEOF},
+		{"invalid block type", "\x07", flate.ErrCorrupt},
+		{"stored length", "\x01\x05\x00\xfa\xfe", flate.ErrCorrupt},
+		{"stored truncated", "\x01\x05\x00\xfa\xffabc", io.ErrUnexpectedEOF},
+		{"fixed truncated", "\x4b", io.ErrUnexpectedEOF}, // "a" is 4b 04 00
+
+		// A fixed block with a match at distance 1 before any output: the
+		// length symbol 257 (0000001) and distance symbol 0 (00000).
+		{"distance", "\x03\x02\x00", flate.ErrCorrupt},
+	}
+	for _, test := range tests {
+		_, err := io.ReadAll(flate.NewReader(strings.NewReader(test.input), nil))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	// Writes after Close are rejected.
+	w := flate.NewWriter(io.Discard, nil)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, flate.ErrClosed) {
+		t.Errorf("Write after Close: got %v, want %v", err, flate.ErrClosed)
+	}
+}
@@ -0,0 +1,315 @@
+package flate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/huffman"
+	"github.com/creachadair/bitstream/internal/bitutil"
+)
+
+// A Reader decompresses a DEFLATE stream.  It implements io.Reader.
+type Reader struct {
+	br   *bitstream.Reader
+	opts *Options
+
+	// Decompressed output is appended to hist, which also retains up to
+	// windowSize bytes of history for matches to refer to.  The bytes
+	// hist[rpos:] have not yet been delivered to the caller.
+	hist []byte
+	rpos int
+	err  error // if non-nil, the error to report once hist is drained
+
+	// The state of the current block.  If inBlock is false, the next input is
+	// a block header.  A stored block has lit == nil, and stored bytes left.
+	block     Block
+	inBlock   bool
+	stored    int
+	lit, dist *huffman.Code
+}
+
+// NewReader returns a Reader that decompresses the DEFLATE stream read from
+// r.  If r implements io.ByteReader, the Reader does not read any input past
+// the end of the compressed stream, so that the caller can continue to read
+// from r afterward.
+func NewReader(r io.Reader, opts *Options) *Reader {
+	bopts := bitOptions()
+	if _, ok := r.(io.ByteReader); ok {
+		bopts.NoReadAhead = true
+	}
+	return &Reader{
+		br:   bitstream.NewReader(r, bopts),
+		opts: opts,
+		hist: make([]byte, 0, 2*windowSize+maxMatch),
+	}
+}
+
+// Read implements the io.Reader interface.  It returns io.EOF after the end
+// of the final block.  If the input ends before the final block is complete,
+// Read reports io.ErrUnexpectedEOF.
+func (r *Reader) Read(data []byte) (int, error) {
+	for r.rpos == len(r.hist) && r.err == nil {
+		r.err = r.step()
+	}
+	n := copy(data, r.hist[r.rpos:])
+	r.rpos += n
+	if n == 0 {
+		return 0, r.err
+	}
+	return n, nil
+}
+
+// Offset returns the bit offset in the compressed stream of the next bit to
+// be read.
+func (r *Reader) Offset() int64 { return r.br.Offset() }
+
+// step decodes more of the stream.  The caller must ensure that all the
+// output decoded so far has been delivered.
+func (r *Reader) step() error {
+	if len(r.hist) > windowSize {
+		n := copy(r.hist, r.hist[len(r.hist)-windowSize:])
+		r.hist, r.rpos = r.hist[:n], n
+	}
+	switch {
+	case !r.inBlock && r.block.Final:
+		return io.EOF
+	case !r.inBlock:
+		return r.readHeader()
+	case r.lit == nil:
+		return r.readStored()
+	default:
+		return r.readCodes()
+	}
+}
+
+// readHeader reads the header of the next block.
+func (r *Reader) readHeader() error {
+	r.block = Block{Start: r.br.Offset()}
+	final, err := r.field(1)
+	if err != nil {
+		return err
+	}
+	btype, err := r.field(2)
+	if err != nil {
+		return err
+	}
+	r.block.Final = final == 1
+	r.inBlock = true
+
+	switch btype {
+	case 0:
+		r.block.Type = Stored
+		r.lit, r.dist = nil, nil
+		if _, err := r.br.Align(false); err != nil {
+			return bitutil.NoEOF(err)
+		}
+		n, err := r.field(16)
+		if err != nil {
+			return err
+		}
+		nc, err := r.field(16)
+		if err != nil {
+			return err
+		} else if nc != n^0xffff {
+			return r.corrupt("stored block length %#04x does not match complement %#04x", n, nc)
+		}
+		r.stored = n
+		return nil
+	case 1:
+		r.block.Type = Fixed
+		r.lit, r.dist = fixedLit, fixedDist
+		return nil
+	case 2:
+		r.block.Type = Dynamic
+		return r.readCodeLengths()
+	default:
+		return r.corrupt("invalid block type %d", btype)
+	}
+}
+
+// readCodeLengths reads the code definitions from the header of a dynamic
+// block, as described in RFC 1951 section 3.2.7.
+func (r *Reader) readCodeLengths() error {
+	nlit, err := r.field(5)
+	if err != nil {
+		return err
+	}
+	ndist, err := r.field(5)
+	if err != nil {
+		return err
+	}
+	nclen, err := r.field(4)
+	if err != nil {
+		return err
+	}
+	nlit, ndist, nclen = nlit+257, ndist+1, nclen+4
+	if nlit > numLitLen || ndist > numDist {
+		return r.corrupt("too many codes (%d literal/length, %d distance)", nlit, ndist)
+	}
+
+	// The lengths of the code length code come first, in a permuted order.
+	var clens [len(clOrder)]int
+	for _, sym := range clOrder[:nclen] {
+		if clens[sym], err = r.field(3); err != nil {
+			return err
+		}
+	}
+	clc, err := huffman.FromLengths(clens[:])
+	if err != nil {
+		return r.corrupt("invalid code length code")
+	}
+
+	// The lengths of the literal/length and distance codes follow as a single
+	// sequence, compressed with the code length code and run-length encoded.
+	lengths := make([]int, nlit+ndist)
+	for i := 0; i < len(lengths); {
+		sym, err := r.symbol(clc)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[i] = sym
+			i++
+			continue
+		}
+		var val, nbits, base int
+		switch sym {
+		case 16:
+			if i == 0 {
+				return r.corrupt("repeated code length with no previous length")
+			}
+			val, nbits, base = lengths[i-1], 2, 3
+		case 17:
+			nbits, base = 3, 3
+		default:
+			nbits, base = 7, 11
+		}
+		n, err := r.field(nbits)
+		if err != nil {
+			return err
+		}
+		n += base
+		if i+n > len(lengths) {
+			return r.corrupt("code lengths overflow the alphabet")
+		}
+		for ; n > 0; n-- {
+			lengths[i] = val
+			i++
+		}
+	}
+	if lengths[endOfBlock] == 0 {
+		return r.corrupt("no code for the end of block")
+	}
+	if r.lit, err = huffman.FromLengths(lengths[:nlit]); err != nil {
+		return r.corrupt("invalid literal/length code")
+	}
+	if r.dist, err = huffman.FromLengths(lengths[nlit:]); err != nil {
+		return r.corrupt("invalid distance code")
+	}
+	return nil
+}
+
+// readStored copies data from the current stored block.
+func (r *Reader) readStored() error {
+	n := min(r.stored, cap(r.hist)-len(r.hist))
+	end := len(r.hist) + n
+	if _, err := io.ReadFull(r.br, r.hist[len(r.hist):end]); err != nil {
+		return bitutil.NoEOF(err)
+	}
+	r.hist = r.hist[:end]
+	r.stored -= n
+	r.block.Size += int64(n)
+	if r.stored == 0 {
+		r.endBlock()
+	}
+	return nil
+}
+
+// readCodes decodes data from the current compressed block, until the block
+// ends or there may not be room for another match.
+func (r *Reader) readCodes() error {
+	for len(r.hist) <= cap(r.hist)-maxMatch {
+		sym, err := r.symbol(r.lit)
+		if err != nil {
+			return err
+		}
+		if sym < endOfBlock {
+			r.hist = append(r.hist, byte(sym))
+			r.block.Size++
+			continue
+		} else if sym == endOfBlock {
+			r.endBlock()
+			return nil
+		} else if sym >= numLitLen {
+			return r.corrupt("invalid length symbol %d", sym)
+		}
+
+		// A match: The length and distance symbols are each followed by extra
+		// bits giving an offset from the base value of the symbol.
+		sym -= endOfBlock + 1
+		n, err := r.field(lengthExtra[sym])
+		if err != nil {
+			return err
+		}
+		length := lengthBase[sym] + n
+
+		dsym, err := r.symbol(r.dist)
+		if err != nil {
+			return err
+		} else if dsym >= numDist {
+			return r.corrupt("invalid distance symbol %d", dsym)
+		}
+		d, err := r.field(distExtra[dsym])
+		if err != nil {
+			return err
+		}
+		dist := distBase[dsym] + d
+		if dist > len(r.hist) {
+			return r.corrupt("distance %d is before the start of the output", dist)
+		}
+
+		// The source and destination of the copy may overlap, so copy one byte
+		// at a time.
+		r.block.Size += int64(length)
+		for i := len(r.hist) - dist; length > 0; length-- {
+			r.hist = append(r.hist, r.hist[i])
+			i++
+		}
+	}
+	return nil
+}
+
+// endBlock records the end of the current block.
+func (r *Reader) endBlock() {
+	r.inBlock = false
+	r.block.End = r.br.Offset()
+	r.opts.onBlock(r.block)
+}
+
+// field reads an n-bit field from the stream.  The stream must not end.
+func (r *Reader) field(n int) (int, error) {
+	var v uint64
+	if _, err := r.br.ReadBits(n, &v); err != nil {
+		return 0, bitutil.NoEOF(err)
+	}
+	return int(v), nil
+}
+
+// symbol decodes a symbol using the code c.  The stream must not end.
+func (r *Reader) symbol(c *huffman.Code) (int, error) {
+	sym, err := c.Decode(r.br)
+	if errors.Is(err, huffman.ErrInvalidCode) {
+		return 0, r.corrupt("invalid Huffman code")
+	}
+	return sym, bitutil.NoEOF(err)
+}
+
+// corrupt returns an error wrapping ErrCorrupt at the current offset.
+func (r *Reader) corrupt(msg string, args ...any) error {
+	return &bitstream.OffsetError{
+		Offset: r.br.Offset(),
+		Err:    fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(msg, args...)),
+	}
+}
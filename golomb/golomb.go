@@ -0,0 +1,216 @@
+// Package golomb implements Golomb and Rice codes over bit streams.
+//
+// A Golomb code with parameter M encodes a non-negative integer v as the
+// quotient v / M in unary, followed by the remainder v % M in truncated
+// binary.  A Rice code is a Golomb code in which M is a power of two, 2^k, so
+// that the remainder is simply the low-order k bits of v.
+//
+// In this package, a quotient q is written in unary as q zero bits followed
+// by a single one bit, as in FLAC.  Like the other variable-length codes of
+// the bitstream package, both parts are written in stream order, with the
+// most-significant bit of the remainder first, regardless of the
+// FieldLowBitFirst option.
+//
+// Signed values, such as prediction residuals, are mapped to unsigned values
+// before encoding by the "zigzag" mapping 0, -1, 1, -2, 2, ...  The
+// EncodeResiduals and DecodeResiduals functions apply this mapping.
+package golomb
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/internal/bitutil"
+)
+
+// MaxQuotient is the largest quotient this package will encode or decode.
+// This limits the length of the unary prefix of a code, and protects decoders
+// from corrupt input.
+const MaxQuotient = 1 << 20
+
+// ErrParameter is reported when a code parameter is out of range.
+var ErrParameter = errors.New("golomb: invalid code parameter")
+
+// A Code encodes and decodes unsigned integers as variable-length codes.
+type Code interface {
+	// Encode appends the code for v to w.
+	Encode(w *bitstream.Writer, v uint64) error
+
+	// Decode reads a code from r and returns the value it encodes.  If the
+	// stream ends before the first bit of a code, Decode returns io.EOF.
+	Decode(r *bitstream.Reader) (uint64, error)
+}
+
+// Rice is a Rice code whose parameter is k, so that the Golomb parameter M is
+// 2^k.  The parameter must satisfy 0 ≤ k ≤ 63.
+type Rice int
+
+// Encode implements part of the Code interface.
+func (c Rice) Encode(w *bitstream.Writer, v uint64) error {
+	if c < 0 || c > 63 {
+		return ErrParameter
+	}
+	if err := writeQuotient(w, v>>c); err != nil {
+		return err
+	}
+	// A truncated binary code for 2^k values is the plain k-bit value.
+	return w.WriteTruncated(1<<c, v&(1<<c-1))
+}
+
+// Decode implements part of the Code interface.
+func (c Rice) Decode(r *bitstream.Reader) (uint64, error) {
+	if c < 0 || c > 63 {
+		return 0, ErrParameter
+	}
+	q, err := readQuotient(r)
+	if err != nil {
+		return 0, err
+	}
+	lo, err := r.ReadTruncated(1 << c)
+	if err != nil {
+		return 0, bitutil.NoEOF(err)
+	}
+	if q > math.MaxUint64>>c {
+		return 0, bitstream.ErrCodeLength
+	}
+	return q<<c | lo, nil
+}
+
+// Golomb is a Golomb code whose parameter is M.  The parameter must be
+// positive.  When M is a power of two, the code is identical to the Rice code
+// with the corresponding parameter.
+type Golomb uint64
+
+// Encode implements part of the Code interface.
+func (c Golomb) Encode(w *bitstream.Writer, v uint64) error {
+	if c == 0 {
+		return ErrParameter
+	}
+	if err := writeQuotient(w, v/uint64(c)); err != nil {
+		return err
+	}
+	return w.WriteTruncated(uint64(c), v%uint64(c))
+}
+
+// Decode implements part of the Code interface.
+func (c Golomb) Decode(r *bitstream.Reader) (uint64, error) {
+	if c == 0 {
+		return 0, ErrParameter
+	}
+	q, err := readQuotient(r)
+	if err != nil {
+		return 0, err
+	}
+	rem, err := r.ReadTruncated(uint64(c))
+	if err != nil {
+		return 0, bitutil.NoEOF(err)
+	}
+	hi, lo := bits.Mul64(q, uint64(c))
+	v, carry := bits.Add64(lo, rem, 0)
+	if hi != 0 || carry != 0 {
+		return 0, bitstream.ErrCodeLength
+	}
+	return v, nil
+}
+
+// writeQuotient writes q to w in unary, as q zeroes followed by a one.
+func writeQuotient(w *bitstream.Writer, q uint64) error {
+	if q > MaxQuotient {
+		return bitstream.ErrCodeLength
+	}
+	return w.WriteUnary(false, int(q))
+}
+
+// readQuotient reads a unary quotient from r, as a run of zeroes terminated by
+// a one.
+func readQuotient(r *bitstream.Reader) (uint64, error) {
+	q, err := r.ReadUnary(false, MaxQuotient)
+	return uint64(q), err
+}
+
+// Zigzag maps a signed value to an unsigned value, so that values of small
+// magnitude have small codes: 0, -1, 1, -2, 2, ... map to 0, 1, 2, 3, 4, ...
+func Zigzag(v int64) uint64 { return uint64(v<<1) ^ uint64(v>>63) }
+
+// Unzigzag is the inverse of Zigzag.
+func Unzigzag(u uint64) int64 { return int64(u>>1) ^ -int64(u&1) }
+
+// EncodeResiduals appends the codes for the zigzag mappings of vs to w, using
+// the code c.  It stops at the first error.
+func EncodeResiduals(w *bitstream.Writer, c Code, vs []int64) error {
+	for _, v := range vs {
+		if err := c.Encode(w, Zigzag(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeResiduals reads codes from r using the code c, and stores their
+// zigzag-decoded values in successive elements of vs.  It returns the number
+// of values decoded, which is len(vs) unless an error occurs.
+func DecodeResiduals(r *bitstream.Reader, c Code, vs []int64) (int, error) {
+	for i := range vs {
+		u, err := c.Decode(r)
+		if err != nil {
+			return i, err
+		}
+		vs[i] = Unzigzag(u)
+	}
+	return len(vs), nil
+}
+
+// RiceParameter returns the Rice parameter k that minimizes the total encoded
+// length of the zigzag mappings of vs, and that length in bits.
+func RiceParameter(vs []int64) (k int, nbits uint64) {
+	best, bestBits := 63, uint64(math.MaxUint64)
+	for k := 0; k < 64; k++ {
+		var sum, maxq uint64 // sum and maximum of quotients
+		for _, v := range vs {
+			q := Zigzag(v) >> k
+			sum += q
+			maxq = max(maxq, q)
+		}
+		if maxq > MaxQuotient {
+			continue // some value cannot be encoded with this parameter
+		}
+		cost := sum + uint64(len(vs))*uint64(k+1)
+		if cost < bestBits {
+			best, bestBits = k, cost
+		}
+		if sum == 0 {
+			break // larger parameters only add remainder bits
+		}
+	}
+	return best, bestBits
+}
+
+// GolombParameter returns an estimate of the Golomb parameter M that
+// minimizes the total encoded length of the zigzag mappings of vs, assuming
+// they are geometrically distributed.
+func GolombParameter(vs []int64) Golomb {
+	if len(vs) == 0 {
+		return 1
+	}
+	var mean float64
+	for _, v := range vs {
+		mean += float64(Zigzag(v))
+	}
+	mean /= float64(len(vs))
+
+	// For a geometric distribution with P(v) = (1-p)p^v, the mean is p/(1-p),
+	// and the optimal parameter is the smallest M with p^M + p^(M+1) ≤ 1.
+	p := mean / (mean + 1)
+	if p == 0 {
+		return 1
+	}
+	m := math.Ceil(-math.Log(1+p) / math.Log(p))
+	if m < 1 || math.IsNaN(m) {
+		return 1
+	} else if m >= math.MaxUint64 {
+		return Golomb(1 << 63)
+	}
+	return Golomb(m)
+}
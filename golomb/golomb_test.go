@@ -0,0 +1,212 @@
+package golomb_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/golomb"
+	"github.com/creachadair/bitstream/internal/bitutil"
+)
+
+func TestCodes(t *testing.T) {
+	tests := []struct {
+		code golomb.Code
+		v    uint64
+		want string // bits
+	}{
+		{golomb.Rice(0), 0, "1"},
+		{golomb.Rice(0), 3, "0001"},
+		{golomb.Rice(2), 0, "100"},
+		{golomb.Rice(2), 6, "0110"},
+		{golomb.Rice(2), 13, "000101"},
+		{golomb.Golomb(1), 2, "001"},
+		{golomb.Golomb(4), 6, "0110"},
+
+		// M = 5: b = 3, u = 3, so remainders 0..2 use 2 bits, 3..4 use 3.
+		{golomb.Golomb(5), 0, "100"},
+		{golomb.Golomb(5), 2, "110"},
+		{golomb.Golomb(5), 3, "1110"},
+		{golomb.Golomb(5), 4, "1111"},
+		{golomb.Golomb(5), 9, "01111"},
+		{golomb.Golomb(5), 10, "00100"},
+
+		// M = 10: b = 4, u = 6.
+		{golomb.Golomb(10), 5, "1101"},
+		{golomb.Golomb(10), 6, "11100"},
+		{golomb.Golomb(10), 19, "011111"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := bitstream.NewWriter(&buf, nil)
+		if err := test.code.Encode(w, test.v); err != nil {
+			t.Errorf("%v Encode(%d): unexpected error: %v", test.code, test.v, err)
+			continue
+		}
+		if got := w.Offset(); got != int64(len(test.want)) {
+			t.Errorf("%v Encode(%d): wrote %d bits, want %d", test.code, test.v, got, len(test.want))
+		}
+		w.Flush()
+		if got := bitutil.BitString(buf.Bytes())[:len(test.want)]; got != test.want {
+			t.Errorf("%v Encode(%d): got %s, want %s", test.code, test.v, got, test.want)
+		}
+
+		r := bitstream.NewReader(&buf, nil)
+		if got, err := test.code.Decode(r); err != nil || got != test.v {
+			t.Errorf("%v Decode: got %d, %v; want %d, nil", test.code, got, err, test.v)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	codes := []golomb.Code{
+		golomb.Rice(0), golomb.Rice(3), golomb.Rice(17), golomb.Rice(63),
+		golomb.Golomb(1), golomb.Golomb(3), golomb.Golomb(7), golomb.Golomb(1000),
+		golomb.Golomb(1<<40 + 1), golomb.Golomb(math.MaxUint64),
+	}
+	for _, opt := range []*bitstream.Options{nil, {LowBitFirst: true}, {LowBitFirst: true, FieldLowBitFirst: true}} {
+		for _, c := range codes {
+			vs := make([]int64, 500)
+			for i := range vs {
+				vs[i] = rng.Int63n(1<<10) - 1<<9
+			}
+			if c == golomb.Rice(63) || c == golomb.Golomb(math.MaxUint64) {
+				vs = append(vs, math.MaxInt64, math.MinInt64)
+			}
+
+			var buf bytes.Buffer
+			w := bitstream.NewWriter(&buf, opt)
+			if err := golomb.EncodeResiduals(w, c, vs); err != nil {
+				t.Fatalf("%v EncodeResiduals: unexpected error: %v", c, err)
+			}
+			w.Flush()
+
+			r := bitstream.NewReader(&buf, opt)
+			got := make([]int64, len(vs))
+			if n, err := golomb.DecodeResiduals(r, c, got); err != nil || n != len(vs) {
+				t.Fatalf("%v DecodeResiduals: got %d, %v; want %d, nil", c, n, err, len(vs))
+			}
+			for i := range vs {
+				if got[i] != vs[i] {
+					t.Errorf("%v value %d: got %d, want %d", c, i, got[i], vs[i])
+				}
+			}
+		}
+
+		// A Golomb code whose parameter is a power of two is a Rice code.
+		for _, k := range []int{0, 1, 2, 5, 17, 63} {
+			var rice, gol bytes.Buffer
+			rw := bitstream.NewWriter(&rice, opt)
+			gw := bitstream.NewWriter(&gol, opt)
+			for i := range uint64(100) {
+				rv := i%2<<k | i*0x9e3779b97f4a7c15&(1<<k-1)
+				if err := golomb.Rice(k).Encode(rw, rv); err != nil {
+					t.Fatalf("Rice(%d).Encode(%d): unexpected error: %v", k, rv, err)
+				}
+				if err := golomb.Golomb(1<<k).Encode(gw, rv); err != nil {
+					t.Fatalf("Golomb(%d).Encode(%d): unexpected error: %v", uint64(1)<<k, rv, err)
+				}
+			}
+			rw.Flush()
+			gw.Flush()
+			if !bytes.Equal(rice.Bytes(), gol.Bytes()) {
+				t.Errorf("%+v: Rice(%d) and Golomb(%d) differ:\n%x\n%x", opt, k, uint64(1)<<k, rice.Bytes(), gol.Bytes())
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	w := bitstream.NewWriter(io.Discard, nil)
+	if err := golomb.Golomb(0).Encode(w, 1); !errors.Is(err, golomb.ErrParameter) {
+		t.Errorf("Golomb(0).Encode: got %v, want %v", err, golomb.ErrParameter)
+	}
+	if err := golomb.Rice(64).Encode(w, 1); !errors.Is(err, golomb.ErrParameter) {
+		t.Errorf("Rice(64).Encode: got %v, want %v", err, golomb.ErrParameter)
+	}
+	if err := golomb.Rice(2).Encode(w, 4*golomb.MaxQuotient+4); !errors.Is(err, bitstream.ErrCodeLength) {
+		t.Errorf("Rice(2).Encode(large): got %v, want %v", err, bitstream.ErrCodeLength)
+	}
+
+	// A long run of zeroes exceeds the quotient limit.
+	r := bitstream.NewReader(bytes.NewReader(make([]byte, golomb.MaxQuotient/8+1)), nil)
+	if _, err := golomb.Rice(0).Decode(r); !errors.Is(err, bitstream.ErrCodeLength) {
+		t.Errorf("Decode(zeroes): got %v, want %v", err, bitstream.ErrCodeLength)
+	}
+
+	// An empty stream reports EOF.
+	r = bitstream.NewReader(strings.NewReader(""), nil)
+	if _, err := golomb.Golomb(3).Decode(r); err != io.EOF {
+		t.Errorf("Decode(empty): got %v, want EOF", err)
+	}
+
+	// Truncated codes are reported.
+	for _, input := range []string{"\x00", "\x01"} {
+		r := bitstream.NewReader(strings.NewReader(input), nil)
+		if _, err := golomb.Rice(3).Decode(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Decode(%q): got %v, want %v", input, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// encodedLength returns the number of bits required to encode vs with c.
+func encodedLength(t *testing.T, c golomb.Code, vs []int64) int64 {
+	t.Helper()
+	w := bitstream.NewWriter(io.Discard, nil)
+	if err := golomb.EncodeResiduals(w, c, vs); err != nil {
+		t.Fatalf("%v EncodeResiduals: unexpected error: %v", c, err)
+	}
+	return w.Offset()
+}
+
+func TestParameters(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, scale := range []float64{0, 0.5, 3, 40, 1000, 1e6} {
+		vs := make([]int64, 1000)
+		for i := range vs {
+			vs[i] = int64(rng.NormFloat64() * scale)
+		}
+
+		// The Rice parameter should be exactly optimal.
+		k, nbits := golomb.RiceParameter(vs)
+		if got := encodedLength(t, golomb.Rice(k), vs); got != int64(nbits) {
+			t.Errorf("Scale %v: RiceParameter reports %d bits, encoding used %d", scale, nbits, got)
+		}
+		for j := max(0, k-2); j <= k+2; j++ {
+			if got := encodedLength(t, golomb.Rice(j), vs); got < int64(nbits) {
+				t.Errorf("Scale %v: Rice(%d) uses %d bits, better than Rice(%d) with %d", scale, j, got, k, nbits)
+			}
+		}
+
+		// The Golomb parameter should be no worse than the best Rice code by
+		// more than a small margin.
+		m := golomb.GolombParameter(vs)
+		if got := encodedLength(t, m, vs); float64(got) > 1.05*float64(nbits) {
+			t.Errorf("Scale %v: Golomb(%d) uses %d bits, Rice(%d) uses %d", scale, m, got, k, nbits)
+		}
+	}
+}
+
+func TestZigzag(t *testing.T) {
+	tests := []struct {
+		v int64
+		u uint64
+	}{
+		{0, 0}, {-1, 1}, {1, 2}, {-2, 3}, {2, 4},
+		{math.MaxInt64, math.MaxUint64 - 1}, {math.MinInt64, math.MaxUint64},
+	}
+	for _, test := range tests {
+		if got := golomb.Zigzag(test.v); got != test.u {
+			t.Errorf("Zigzag(%d): got %d, want %d", test.v, got, test.u)
+		}
+		if got := golomb.Unzigzag(test.u); got != test.v {
+			t.Errorf("Unzigzag(%d): got %d, want %d", test.u, got, test.v)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+// Package huffman implements canonical Huffman codes over bit streams.
+//
+// A canonical code is fully determined by the length of the codeword assigned
+// to each symbol: Codewords are assigned in order of increasing length, and
+// among codewords of the same length, in order of increasing symbol value.
+// This is the convention used by DEFLATE, JPEG, and many other formats, and
+// means that only the lengths need to be stored to reproduce a code.
+//
+// Codewords are written to the stream starting with their first bit, so that
+// a prefix of the stream identifies each codeword uniquely.  This does not
+// depend on the FieldLowBitFirst option of the reader or writer.  Decoding
+// uses a multi-level lookup table indexed by bits peeked from the stream,
+// rather than walking a tree one bit at a time.
+package huffman
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"slices"
+
+	"github.com/creachadair/bitstream"
+)
+
+// MaxLength is the longest codeword length supported by this package.
+const MaxLength = 32
+
+var (
+	// ErrLengths is reported when a set of code lengths does not describe a
+	// valid prefix code.
+	ErrLengths = errors.New("huffman: invalid code lengths")
+
+	// ErrMaxLength is reported when there are too many symbols to assign each
+	// a codeword of the requested maximum length.
+	ErrMaxLength = errors.New("huffman: maximum length too small")
+
+	// ErrSymbol is reported when asked to encode a symbol that has no
+	// codeword.
+	ErrSymbol = errors.New("huffman: symbol not in code")
+
+	// ErrInvalidCode is reported when the stream contains bits that do not
+	// begin any codeword.
+	ErrInvalidCode = errors.New("huffman: invalid codeword")
+)
+
+// tableBits is the maximum number of bits used to index each level of the
+// decoding table.
+const tableBits = 9
+
+// A Code is a canonical prefix code for the symbols 0 to n-1.  A Code is safe
+// for concurrent use by multiple goroutines.
+type Code struct {
+	lengths []uint8  // codeword length for each symbol, 0 if unused
+	codes   []uint32 // codeword for each symbol, in the low-order bits
+	maxLen  int      // length of the longest codeword
+
+	// The decoding table comprises a root table of rootBits entries, followed
+	// by the subtables for longer codes.
+	table    []entry
+	rootBits int
+}
+
+// An entry is an element of a decoding table.  If sub == 0, the entry is a
+// leaf for the symbol value, with a codeword of length bits.  Otherwise, the
+// entry refers to a subtable of width sub starting at offset value.  An entry
+// with length == sub == 0 matches no codeword.
+type entry struct {
+	value  int32
+	length uint8
+	sub    uint8
+}
+
+// FromLengths constructs the canonical code in which symbol i has a codeword
+// of lengths[i] bits.  A length of 0 means the symbol does not occur.  The
+// lengths must satisfy 0 ≤ lengths[i] ≤ MaxLength, and must not describe more
+// codewords than fit in a prefix code.  Incomplete codes are permitted, but
+// reading a sequence of bits not assigned to any codeword will report an
+// error.
+func FromLengths(lengths []int) (*Code, error) {
+	c := &Code{
+		lengths: make([]uint8, len(lengths)),
+		codes:   make([]uint32, len(lengths)),
+	}
+
+	// Count the codewords of each length, and check that they fit.
+	var count [MaxLength + 1]int
+	for i, n := range lengths {
+		if n < 0 || n > MaxLength {
+			return nil, ErrLengths
+		}
+		c.lengths[i] = uint8(n)
+		c.maxLen = max(c.maxLen, n)
+		count[n]++
+	}
+	count[0] = 0
+	var space uint64 = 1 << MaxLength
+	for n := 1; n <= MaxLength; n++ {
+		used := uint64(count[n]) << (MaxLength - n)
+		if used > space {
+			return nil, ErrLengths
+		}
+		space -= used
+	}
+
+	// Assign codewords in order of length, and by symbol within each length.
+	var next [MaxLength + 1]uint32
+	var code uint32
+	for n := 1; n <= MaxLength; n++ {
+		code = (code + uint32(count[n-1])) << 1
+		next[n] = code
+	}
+	for i, n := range c.lengths {
+		if n != 0 {
+			c.codes[i] = next[n]
+			next[n]++
+		}
+	}
+	c.buildTable()
+	return c, nil
+}
+
+// FromFrequencies constructs a canonical code for symbols whose frequencies
+// of occurrence are given by freqs, in which no codeword is longer than
+// maxLen bits.  Symbols with frequency 0 are not assigned codewords.  It is
+// equivalent to calling FromLengths with the result of Lengths.
+func FromFrequencies(freqs []uint64, maxLen int) (*Code, error) {
+	lengths, err := Lengths(freqs, maxLen)
+	if err != nil {
+		return nil, err
+	}
+	return FromLengths(lengths)
+}
+
+// Lengths returns the codeword lengths of an optimal prefix code for symbols
+// whose frequencies of occurrence are given by freqs, subject to the
+// constraint that no codeword is longer than maxLen bits, where 1 ≤ maxLen ≤
+// MaxLength.  Symbols with frequency 0 are assigned length 0.  If only one
+// symbol has a non-zero frequency, it is assigned length 1.
+//
+// Lengths reports ErrMaxLength if there are more than 2^maxLen symbols with
+// non-zero frequency.
+func Lengths(freqs []uint64, maxLen int) ([]int, error) {
+	if maxLen < 1 || maxLen > MaxLength {
+		return nil, ErrMaxLength
+	}
+	lengths := make([]int, len(freqs))
+
+	// Construct leaves for the symbols that occur, ordered by frequency, with
+	// ties broken by symbol value so that the result is deterministic.
+	var nodes []node
+	for i, f := range freqs {
+		if f != 0 {
+			nodes = append(nodes, node{weight: f, sym: int32(i)})
+		}
+	}
+	nleaves := len(nodes)
+	switch {
+	case nleaves == 0:
+		return lengths, nil
+	case nleaves == 1:
+		lengths[nodes[0].sym] = 1
+		return lengths, nil
+	case uint64(nleaves) > 1<<maxLen:
+		return nil, ErrMaxLength
+	}
+	slices.SortStableFunc(nodes, func(a, b node) int {
+		if a.weight < b.weight {
+			return -1
+		} else if a.weight > b.weight {
+			return 1
+		}
+		return 0
+	})
+
+	// This is the package-merge algorithm of Larmore and Hirschberg.  At each
+	// of maxLen-1 stages, adjacent pairs of the previous list are packaged and
+	// the packages merged with the leaves.  The 2n-2 lightest items of the
+	// final list determine the lengths: each symbol's length is the number of
+	// those items in which it occurs.
+	leaves := make([]int32, nleaves)
+	for i := range leaves {
+		leaves[i] = int32(i)
+	}
+	list := leaves
+	for stage := 1; stage < maxLen; stage++ {
+		next := make([]int32, 0, nleaves+len(list)/2)
+		i := 0
+		for j := 0; j+1 < len(list); j += 2 {
+			pkg := node{
+				weight: addSat(nodes[list[j]].weight, nodes[list[j+1]].weight),
+				left:   list[j],
+				right:  list[j+1],
+				sym:    -1,
+			}
+			for i < nleaves && nodes[leaves[i]].weight <= pkg.weight {
+				next = append(next, leaves[i])
+				i++
+			}
+			nodes = append(nodes, pkg)
+			next = append(next, int32(len(nodes)-1))
+		}
+		list = append(next, leaves[i:]...)
+	}
+	var count func(int32)
+	count = func(i int32) {
+		if nd := nodes[i]; nd.sym >= 0 {
+			lengths[nd.sym]++
+		} else {
+			count(nd.left)
+			count(nd.right)
+		}
+	}
+	for _, i := range list[:2*nleaves-2] {
+		count(i)
+	}
+	return lengths, nil
+}
+
+// A node is a leaf or package in the package-merge algorithm.  Leaves have sym
+// ≥ 0; packages have sym < 0 and refer to their two constituents by index.
+type node struct {
+	weight      uint64
+	left, right int32
+	sym         int32
+}
+
+// addSat returns a + b, saturating at math.MaxUint64.
+func addSat(a, b uint64) uint64 {
+	if s := a + b; s >= a {
+		return s
+	}
+	return math.MaxUint64
+}
+
+// NumSymbols reports the number of symbols in the alphabet of c, including
+// symbols that have no codeword.
+func (c *Code) NumSymbols() int { return len(c.lengths) }
+
+// Lengths returns the codeword lengths of c, indexed by symbol.  A length of
+// 0 means the symbol has no codeword.
+func (c *Code) Lengths() []int {
+	out := make([]int, len(c.lengths))
+	for i, n := range c.lengths {
+		out[i] = int(n)
+	}
+	return out
+}
+
+// Codeword returns the codeword for sym, in the low-order n bits of code,
+// with the first bit of the codeword in the most-significant position.  If
+// sym has no codeword, n == 0.
+func (c *Code) Codeword(sym int) (code uint64, n int) {
+	if sym < 0 || sym >= len(c.lengths) {
+		return 0, 0
+	}
+	return uint64(c.codes[sym]), int(c.lengths[sym])
+}
+
+// Encode appends the codeword for sym to w.  It reports ErrSymbol if sym has
+// no codeword in c.
+func (c *Code) Encode(w *bitstream.Writer, sym int) error {
+	code, n := c.Codeword(sym)
+	if n == 0 {
+		return ErrSymbol
+	}
+	if w.Options().FieldLowBitFirst {
+		code = bits.Reverse64(code) >> (64 - n)
+	}
+	_, err := w.WriteBits(n, code)
+	return err
+}
+
+// Decode reads a codeword from r and returns its symbol.  If the stream ends
+// before the first bit of a codeword, Decode returns io.EOF; if it ends
+// partway through a codeword, it reports io.ErrUnexpectedEOF.  If the next
+// bits of the stream do not begin any codeword, Decode reports ErrInvalidCode
+// and r is not advanced.
+//
+// If r has the NoReadAhead option, Decode does not read any input past the end
+// of the codeword.
+func (c *Code) Decode(r *bitstream.Reader) (int, error) {
+	if c.maxLen == 0 {
+		return 0, ErrInvalidCode
+	}
+
+	// With NoReadAhead, start with the bits remaining in the current byte,
+	// which have already been read, and peek one more byte at a time until the
+	// codeword is resolved.
+	want := c.maxLen
+	if r.Options().NoReadAhead {
+		want = min(r.Padding(), c.maxLen)
+	}
+	for {
+		var v uint64
+		n, err := r.PeekBits(want, &v)
+		if n == 0 && err != nil {
+			return 0, err
+		} else if err != nil && err != io.EOF {
+			return 0, err
+		}
+		sym, length := c.lookup(r, v, n)
+		if length != 0 && length <= n {
+			r.SkipBits(length)
+			return sym, nil
+		} else if n < want || want == c.maxLen {
+			// No more bits are available, or all of them have been examined.
+			if length == 0 {
+				return 0, ErrInvalidCode
+			}
+			return 0, io.ErrUnexpectedEOF
+		}
+		want = min(want+8, c.maxLen)
+	}
+}
+
+// lookup finds the table entry for the n bits of v, as peeked from r, and
+// returns its symbol and codeword length.  The result is the codeword that
+// begins the stream only if its length is at most n.  If no codeword begins
+// with the bits of v, the length is 0.
+func (c *Code) lookup(r *bitstream.Reader, v uint64, n int) (sym, length int) {
+	if n > 0 && r.Options().FieldLowBitFirst {
+		v = bits.Reverse64(v) >> (64 - n)
+	}
+	v <<= c.maxLen - n // pad with zeroes to the longest codeword
+
+	depth, base, width := 0, 0, c.rootBits
+	for {
+		shift := c.maxLen - depth - width
+		e := c.table[base+int(v>>shift&(1<<width-1))]
+		if e.sub == 0 {
+			return int(e.value), int(e.length)
+		}
+		depth += width
+		base, width = int(e.value), int(e.sub)
+	}
+}
+
+// A codeword is a symbol and its codeword, used to construct the table.
+type codeword struct {
+	sym    int32
+	code   uint32
+	length int
+}
+
+// prefix returns the first n bits of the codeword, padded with zeroes if the
+// codeword is shorter than n bits.
+func (cw codeword) prefix(n int) uint32 {
+	if n <= cw.length {
+		return cw.code >> (cw.length - n)
+	}
+	return cw.code << (n - cw.length)
+}
+
+// buildTable constructs the decoding table for c.
+func (c *Code) buildTable() {
+	var cws []codeword
+	for i, n := range c.lengths {
+		if n != 0 {
+			cws = append(cws, codeword{sym: int32(i), code: c.codes[i], length: int(n)})
+		}
+	}
+	if len(cws) == 0 {
+		return
+	}
+
+	// Order the codewords as binary fractions, so that the codewords sharing
+	// any given prefix are contiguous.
+	slices.SortFunc(cws, func(a, b codeword) int {
+		pa, pb := a.prefix(MaxLength), b.prefix(MaxLength)
+		if pa < pb {
+			return -1
+		} else if pa > pb {
+			return 1
+		}
+		return 0
+	})
+	c.table = nil
+	_, c.rootBits = c.addTable(cws, 0)
+}
+
+// addTable appends to c.table a table for the codewords in cws, which share a
+// common prefix of depth bits and are longer than depth.  It returns the
+// offset and width of the new table.
+func (c *Code) addTable(cws []codeword, depth int) (base, width int) {
+	var longest int
+	for _, cw := range cws {
+		longest = max(longest, cw.length)
+	}
+	width = min(tableBits, longest-depth)
+	base = len(c.table)
+	c.table = append(c.table, make([]entry, 1<<width)...)
+
+	end := depth + width
+	mask := uint32(1)<<width - 1
+	for i := 0; i < len(cws); {
+		cw := cws[i]
+		idx := int(cw.prefix(end) & mask)
+		if cw.length <= end {
+			// All the entries beginning with this codeword are leaves for it.
+			span := 1 << (end - cw.length)
+			for j := range span {
+				c.table[base+idx+j] = entry{value: cw.sym, length: uint8(cw.length)}
+			}
+			i++
+			continue
+		}
+
+		// Longer codewords sharing this prefix go into a subtable.
+		j := i + 1
+		for j < len(cws) && cws[j].prefix(end) == cw.prefix(end) {
+			j++
+		}
+		sub, sw := c.addTable(cws[i:j], end)
+		c.table[base+idx] = entry{value: int32(sub), sub: uint8(sw)}
+		i = j
+	}
+	return base, width
+}
@@ -0,0 +1,313 @@
+package huffman_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/huffman"
+	"github.com/creachadair/bitstream/internal/bitutil"
+)
+
+func TestFromLengths(t *testing.T) {
+	// This is the example from RFC 1951 section 3.2.2.
+	c, err := huffman.FromLengths([]int{3, 3, 3, 3, 3, 2, 4, 4})
+	if err != nil {
+		t.Fatalf("FromLengths: unexpected error: %v", err)
+	}
+	want := []string{"010", "011", "100", "101", "110", "00", "1110", "1111"}
+	for sym, w := range want {
+		code, n := c.Codeword(sym)
+		if got := fmt.Sprintf("%0*b", n, code); got != w {
+			t.Errorf("Codeword(%d): got %s, want %s", sym, got, w)
+		}
+
+		// Codewords are written in stream order regardless of field order.
+		for _, opt := range []*bitstream.Options{nil, {FieldLowBitFirst: true}} {
+			var buf bytes.Buffer
+			bw := bitstream.NewWriter(&buf, opt)
+			if err := c.Encode(bw, sym); err != nil {
+				t.Errorf("Encode(%d): unexpected error: %v", sym, err)
+				continue
+			}
+			bw.Flush()
+			if got := bitutil.BitString(buf.Bytes())[:len(w)]; got != w {
+				t.Errorf("Encode(%d): got %s, want %s", sym, got, w)
+			}
+			r := bitstream.NewReader(&buf, opt)
+			if got, err := c.Decode(r); err != nil || got != sym {
+				t.Errorf("Decode: got %d, %v; want %d, nil", got, err, sym)
+			}
+		}
+	}
+	if got := c.Lengths(); !slices.Equal(got, []int{3, 3, 3, 3, 3, 2, 4, 4}) {
+		t.Errorf("Lengths: got %v", got)
+	}
+
+	// Invalid length sets are rejected.
+	for _, lengths := range [][]int{
+		{1, 1, 1},
+		{2, 2, 2, 2, 2},
+		{-1, 1},
+		{huffman.MaxLength + 1, 1},
+	} {
+		if _, err := huffman.FromLengths(lengths); !errors.Is(err, huffman.ErrLengths) {
+			t.Errorf("FromLengths(%v): got %v, want %v", lengths, err, huffman.ErrLengths)
+		}
+	}
+}
+
+// cost returns the total encoded length of symbols with the given frequencies
+// and code lengths.
+func cost(freqs []uint64, lengths []int) uint64 {
+	var sum uint64
+	for i, f := range freqs {
+		sum += f * uint64(lengths[i])
+	}
+	return sum
+}
+
+// huffmanCost returns the total encoded length of symbols with the given
+// frequencies using an unconstrained Huffman code.
+func huffmanCost(freqs []uint64) uint64 {
+	var ws []uint64
+	for _, f := range freqs {
+		if f != 0 {
+			ws = append(ws, f)
+		}
+	}
+	if len(ws) == 1 {
+		return ws[0]
+	}
+	var sum uint64
+	for len(ws) > 1 {
+		slices.Sort(ws)
+		w := ws[0] + ws[1]
+		sum += w
+		ws = append(ws[2:], w)
+	}
+	return sum
+}
+
+// kraft reports whether lengths describe a complete prefix code.
+func kraft(lengths []int) bool {
+	var sum uint64
+	for _, n := range lengths {
+		if n != 0 {
+			sum += 1 << (huffman.MaxLength - n)
+		}
+	}
+	return sum == 1<<huffman.MaxLength
+}
+
+func TestLengths(t *testing.T) {
+	tests := []struct {
+		freqs  []uint64
+		maxLen int
+		want   []int
+	}{
+		{nil, 8, []int{}},
+		{[]uint64{0, 0}, 8, []int{0, 0}},
+		{[]uint64{0, 5, 0}, 8, []int{0, 1, 0}},
+		{[]uint64{3, 5}, 1, []int{1, 1}},
+		{[]uint64{1, 1, 2, 4, 8}, 8, []int{4, 4, 3, 2, 1}},
+		{[]uint64{1, 1, 2, 4, 8}, 3, []int{3, 3, 3, 3, 1}},
+		{[]uint64{1, 1, 2, 4, 8}, 2, nil}, // too many symbols
+		{[]uint64{8, 0, 1, 4, 2, 1}, 8, []int{1, 0, 4, 2, 3, 4}},
+	}
+	for _, test := range tests {
+		got, err := huffman.Lengths(test.freqs, test.maxLen)
+		if test.want == nil {
+			if !errors.Is(err, huffman.ErrMaxLength) {
+				t.Errorf("Lengths(%v, %d): got %v, %v; want %v", test.freqs, test.maxLen, got, err, huffman.ErrMaxLength)
+			}
+		} else if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("Lengths(%v, %d): got %v, %v; want %v, nil", test.freqs, test.maxLen, got, err, test.want)
+		}
+	}
+
+	// Check optimality and length limits for randomly-chosen frequencies.
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		freqs := make([]uint64, 2+rng.Intn(300))
+		for j := range freqs {
+			// Exponentially-distributed frequencies give long codes.
+			freqs[j] = uint64(rng.ExpFloat64() * float64(int(1)<<rng.Intn(24)))
+		}
+		freqs[0]++ // ensure at least one symbol occurs
+		freqs[1]++
+
+		lengths, err := huffman.Lengths(freqs, huffman.MaxLength)
+		if err != nil {
+			t.Fatalf("Lengths: unexpected error: %v", err)
+		}
+		if !kraft(lengths) {
+			t.Errorf("Lengths(%v): %v is not a complete code", freqs, lengths)
+		}
+		if got, want := cost(freqs, lengths), huffmanCost(freqs); got != want {
+			t.Errorf("Lengths(%v): cost is %d, want %d", freqs, got, want)
+		}
+
+		// Limiting the length should not do better than the unconstrained code,
+		// and must respect the limit.
+		limited, err := huffman.Lengths(freqs, 9)
+		if err != nil {
+			t.Fatalf("Lengths: unexpected error: %v", err)
+		}
+		if !kraft(limited) {
+			t.Errorf("Lengths(%v, 9): %v is not a complete code", freqs, limited)
+		}
+		if got := slices.Max(limited); got > 9 {
+			t.Errorf("Lengths(%v, 9): longest code is %d", freqs, got)
+		}
+		if got, min := cost(freqs, limited), cost(freqs, lengths); got < min {
+			t.Errorf("Lengths(%v, 9): cost is %d, less than optimal %d", freqs, got, min)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+
+	// Fibonacci frequencies produce the longest possible codes.
+	fib := []uint64{1, 1}
+	for len(fib) < 30 {
+		fib = append(fib, fib[len(fib)-1]+fib[len(fib)-2])
+	}
+	alphabets := [][]uint64{fib, {1}, {0, 7, 0, 0, 3}}
+	for i := 0; i < 10; i++ {
+		freqs := make([]uint64, 1+rng.Intn(1000))
+		for j := range freqs {
+			freqs[j] = uint64(rng.Intn(1 << rng.Intn(20)))
+		}
+		alphabets = append(alphabets, freqs)
+	}
+
+	for _, opt := range []*bitstream.Options{nil, {LowBitFirst: true}, {LowBitFirst: true, FieldLowBitFirst: true}} {
+		for _, freqs := range alphabets {
+			for _, maxLen := range []int{huffman.MaxLength, 12} {
+				c, err := huffman.FromFrequencies(freqs, maxLen)
+				if errors.Is(err, huffman.ErrMaxLength) {
+					continue
+				} else if err != nil {
+					t.Fatalf("FromFrequencies: unexpected error: %v", err)
+				}
+
+				var syms []int
+				for sym, f := range freqs {
+					if f != 0 {
+						syms = append(syms, sym, sym)
+					}
+				}
+				rng.Shuffle(len(syms), func(i, j int) { syms[i], syms[j] = syms[j], syms[i] })
+
+				var buf bytes.Buffer
+				w := bitstream.NewWriter(&buf, opt)
+				for _, sym := range syms {
+					if err := c.Encode(w, sym); err != nil {
+						t.Fatalf("Encode(%d): unexpected error: %v", sym, err)
+					}
+				}
+				w.Flush()
+
+				r := bitstream.NewReader(&buf, opt)
+				for i, sym := range syms {
+					if got, err := c.Decode(r); err != nil || got != sym {
+						t.Fatalf("Decode #%d: got %d, %v; want %d, nil", i, got, err, sym)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNoReadAhead(t *testing.T) {
+	// With the NoReadAhead option, Decode does not consume input past the end
+	// of the codeword, even when the longest codeword would extend into the
+	// bytes that follow.
+	c, err := huffman.FromLengths([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 12})
+	if err != nil {
+		t.Fatalf("FromLengths: unexpected error: %v", err)
+	}
+	for _, opt := range []*bitstream.Options{{NoReadAhead: true}, {NoReadAhead: true, LowBitFirst: true, FieldLowBitFirst: true}} {
+		for _, syms := range [][]int{{0}, {1, 0}, {12, 0}, {3, 11, 2}} {
+			var buf bytes.Buffer
+			w := bitstream.NewWriter(&buf, opt)
+			for _, sym := range syms {
+				if err := c.Encode(w, sym); err != nil {
+					t.Fatalf("Encode(%d): unexpected error: %v", sym, err)
+				}
+			}
+			w.Flush()
+			buf.WriteString("trailer")
+
+			src := bytes.NewReader(buf.Bytes())
+			r := bitstream.NewReader(src, opt)
+			for i, sym := range syms {
+				if got, err := c.Decode(r); err != nil || got != sym {
+					t.Fatalf("%+v %v: Decode #%d: got %d, %v; want %d, nil", opt, syms, i, got, err, sym)
+				}
+			}
+			if rest, _ := io.ReadAll(src); string(rest) != "trailer" {
+				t.Errorf("%+v %v: remaining input: got %q, want %q", opt, syms, rest, "trailer")
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, err := huffman.FromLengths([]int{1, 0, 2, 3}) // 0, -, 10, 110
+	if err != nil {
+		t.Fatalf("FromLengths: unexpected error: %v", err)
+	}
+	w := bitstream.NewWriter(io.Discard, nil)
+	for _, sym := range []int{-1, 1, 4} {
+		if err := c.Encode(w, sym); !errors.Is(err, huffman.ErrSymbol) {
+			t.Errorf("Encode(%d): got %v, want %v", sym, err, huffman.ErrSymbol)
+		}
+	}
+
+	// The codeword 111 is not assigned.
+	r := bitstream.NewReader(strings.NewReader("\xe0"), nil)
+	if _, err := c.Decode(r); !errors.Is(err, huffman.ErrInvalidCode) {
+		t.Errorf("Decode(111): got %v, want %v", err, huffman.ErrInvalidCode)
+	}
+	if got := r.Offset(); got != 0 {
+		t.Errorf("Decode(111): offset is %d, want 0", got)
+	}
+
+	// An empty stream reports EOF.
+	r = bitstream.NewReader(strings.NewReader(""), nil)
+	if _, err := c.Decode(r); err != io.EOF {
+		t.Errorf("Decode(empty): got %v, want EOF", err)
+	}
+
+	// Truncated codewords are reported.
+	r = bitstream.NewReader(strings.NewReader("\x00"), nil)
+	var sym uint64
+	r.ReadBits(7, &sym)
+	if got, err := c.Decode(r); err != nil || got != 0 {
+		t.Errorf("Decode(0): got %d, %v; want 0, nil", got, err)
+	}
+	r = bitstream.NewReader(strings.NewReader("\xff"), nil)
+	r.ReadBits(7, &sym)
+	if _, err := c.Decode(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Decode(1): got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// An empty code decodes nothing.
+	empty, err := huffman.FromLengths(make([]int, 4))
+	if err != nil {
+		t.Fatalf("FromLengths: unexpected error: %v", err)
+	}
+	r = bitstream.NewReader(strings.NewReader("\x00"), nil)
+	if _, err := empty.Decode(r); !errors.Is(err, huffman.ErrInvalidCode) {
+		t.Errorf("Decode(empty code): got %v, want %v", err, huffman.ErrInvalidCode)
+	}
+}
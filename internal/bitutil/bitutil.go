@@ -0,0 +1,29 @@
+// Package bitutil provides small helpers shared by the packages and tests of
+// this module.
+package bitutil
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NoEOF converts io.EOF to io.ErrUnexpectedEOF, for use where the stream is
+// not permitted to end, such as after part of a code has been consumed.
+// Other errors are returned unmodified.
+func NoEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// BitString renders data as a string of binary digits, high-order bit of each
+// byte first.
+func BitString(data []byte) string {
+	var sb strings.Builder
+	for _, b := range data {
+		fmt.Fprintf(&sb, "%08b", b)
+	}
+	return sb.String()
+}
@@ -1,22 +1,25 @@
 package bitstream
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 )
 
 // Read reads an arbitrary number of bytes from a bitstream.Reader.  It
-// implements io.Reader, so it returns the total number of bytes read.  If r
-// did not contain a round number of bytes, the final byte is padded with
-// zeroes in its low-order bits.
+// implements io.Reader, so it returns the total number of bytes read.  Each
+// byte is read as an 8-bit field, as by ReadByte.  If r did not contain a
+// round number of bytes, the final byte is padded with zeroes in the bits
+// that would have been read last.
 func (r *Reader) Read(data []byte) (int, error) {
 	var (
 		v     uint64 // value read from the stream
 		nread int    // total bytes read
 		err   error
 
-		pos = 0               // byte offset into data
-		buf = make([]byte, 8) // temporary buffer for decoding
+		pos = 0     // byte offset into data
+		buf [8]byte // temporary buffer for decoding
 	)
 	for pos < len(data) && err != io.EOF {
 		next := pos + 8
@@ -26,14 +29,18 @@ func (r *Reader) Read(data []byte) (int, error) {
 		want := 8 * (next - pos)
 		var nbits int
 		nbits, err = r.ReadBits(want, &v)
-		v <<= 64 - uint(nbits) // zero-fill the low-order bits
 		if err != nil && err != io.EOF {
 			return nread, err
 		}
 
 		// Unpack the value into the temporary buffer.  We can't safely unpack
-		// directly into data because it might not have enough room.
-		binary.BigEndian.PutUint64(buf, v)
+		// directly into data because it might not have enough room.  When the
+		// low-order bit of a field comes first, so does its low-order byte.
+		if r.opts.fieldLowBitFirst() {
+			binary.LittleEndian.PutUint64(buf[:], v)
+		} else {
+			binary.BigEndian.PutUint64(buf[:], v<<(64-uint(nbits))) // zero-fill the low-order bits
+		}
 		ncopied := bitsToBytes(nbits)
 		copy(data[pos:], buf[:ncopied])
 		pos = next
@@ -42,16 +49,62 @@ func (r *Reader) Read(data []byte) (int, error) {
 	return nread, err
 }
 
+// ReadByte reads the next 8 bits from r as a byte.  It implements
+// io.ByteReader.  If no bits remain, ReadByte returns io.EOF; if fewer than 8
+// bits remain, they are consumed and ReadByte reports io.ErrUnexpectedEOF.
+func (r *Reader) ReadByte() (byte, error) {
+	var v uint64
+	n, err := r.ReadBits(8, &v)
+	if err != nil {
+		return 0, shortRead(r, n, err)
+	}
+	return byte(v), nil
+}
+
+// ErrNotAligned is reported when an operation requiring the stream to be at a
+// byte boundary is attempted elsewhere.
+var ErrNotAligned = errors.New("stream is not byte aligned")
+
+// Remainder returns an io.Reader that yields the bytes buffered by r but not
+// yet read, followed by the rest of the underlying reader.  This allows the
+// caller to resume reading the input byte-wise after r has been used to
+// decode a bit-level prefix.  It is an error if r is not at a byte boundary;
+// see Align.
+//
+// Remainder transfers the buffered data to the returned reader, so r should
+// not be used for reading after Remainder succeeds.
+func (r *Reader) Remainder() (io.Reader, error) {
+	if r.Padding() != 0 {
+		return nil, offsetError(r.off, ErrNotAligned)
+	}
+	var buf []byte
+	for i := int(r.nb) - 8; i >= 0; i -= 8 {
+		buf = append(buf, byte(r.buf>>i))
+	}
+	for i := int(r.nn) - 8; i >= 0; i -= 8 {
+		buf = append(buf, byte(r.next>>i))
+	}
+	buf = append(r.opts.flipBits(buf), r.data[r.pos:]...)
+	r.nb, r.nn = 0, 0
+	r.data, r.pos = r.data[:0], 0
+	return io.MultiReader(bytes.NewReader(buf), r.r), nil
+}
+
 // Write writes an an arbitrary number of bytes to a bitstream.Writer.  It
 // implements io.Writer, so it returns the total number of bytes written,
-// rounded up.  This function does not flush w.
+// rounded up.  Each byte is written as an 8-bit field, as by WriteByte.  This
+// function does not flush w.
 func (w *Writer) Write(data []byte) (int, error) {
 	pos := 0   // offset into data of next unwritten byte
 	nbits := 0 // number of bits written
 
 	// Handle all the full-size chunks, if any.
+	order := binary.ByteOrder(binary.BigEndian)
+	if w.opts.fieldLowBitFirst() {
+		order = binary.LittleEndian
+	}
 	for pos+8 < len(data) {
-		v := binary.BigEndian.Uint64(data[pos:])
+		v := order.Uint64(data[pos:])
 		nw, err := w.WriteBits(64, v)
 		if err != nil {
 			return bitsToBytes(nbits), err
@@ -63,8 +116,12 @@ func (w *Writer) Write(data []byte) (int, error) {
 	// Handle any leftovers.
 	if pos < len(data) {
 		var v uint64
-		for _, b := range data[pos:] {
-			v = (v << 8) | uint64(b)
+		for i, b := range data[pos:] {
+			if w.opts.fieldLowBitFirst() {
+				v |= uint64(b) << (8 * i)
+			} else {
+				v = (v << 8) | uint64(b)
+			}
 		}
 		nw, err := w.WriteBits(8*len(data[pos:]), v)
 		if err != nil {
@@ -76,4 +133,11 @@ func (w *Writer) Write(data []byte) (int, error) {
 	return bitsToBytes(nbits), nil
 }
 
+// WriteByte appends the 8 bits of c to the stream.  It implements
+// io.ByteWriter.
+func (w *Writer) WriteByte(c byte) error {
+	_, err := w.WriteBits(8, uint64(c))
+	return err
+}
+
 func bitsToBytes(n int) int { return (n + 7) / 8 }
@@ -0,0 +1,353 @@
+// Package lzw implements the variable-width Lempel-Ziv-Welch compressed data
+// format used by GIF, TIFF, and PDF, over bit streams.
+//
+// Codes are packed into bytes in one of two orders.  GIF packs codes starting
+// from the least-significant bit of each byte and of each code, while TIFF
+// and PDF pack codes starting from the most-significant bit.  The LowBitFirst
+// option selects between them.
+//
+// In both orders, the first two codes after the literals are special: the
+// clear code, which resets the code table, and the end of information (EOI)
+// code, which ends the stream.  Codes start out one bit wider than the
+// literals, and grow by one bit each time the table fills up to the current
+// width, up to the maximum width.  TIFF and PDF streams normally use "early
+// change", in which the width grows one code earlier than in GIF; this is
+// selected by the EarlyChange option.
+//
+// The Writer emits a clear code at the start of the stream, and whenever the
+// code table becomes full.  In the modes it supports, its output is identical
+// to that of the standard compress/lzw package.
+package lzw
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/creachadair/bitstream"
+)
+
+// ErrCorrupt is reported when the compressed input is not a valid LZW stream.
+// Errors reporting corrupt input wrap ErrCorrupt in a *bitstream.OffsetError
+// giving the bit offset of the problem.
+var ErrCorrupt = errors.New("lzw: corrupt input")
+
+// ErrOptions is reported when the options for a Reader or Writer are invalid.
+var ErrOptions = errors.New("lzw: invalid options")
+
+// ErrClosed is reported when writing to a Writer that has been closed.
+var ErrClosed = errors.New("lzw: writer is closed")
+
+// Options control the behaviour of a Reader or Writer.  A nil *Options is
+// equivalent to a zero-valued Options.
+type Options struct {
+	// If true, codes are packed starting from the least-significant bit, as
+	// in GIF.  Otherwise codes are packed starting from the most-significant
+	// bit, as in TIFF and PDF.
+	LowBitFirst bool
+
+	// The number of bits in each literal, from 2 to 8.  If zero, 8 is used.
+	LitWidth int
+
+	// The maximum width of a code, from LitWidth+1 to 16.  If zero, 12 is used,
+	// as required by GIF, TIFF and PDF.
+	MaxWidth int
+
+	// If true, the code width grows one code earlier than otherwise, as in
+	// TIFF and PDF.
+	EarlyChange bool
+}
+
+// params returns the literal and maximum code widths and the early change
+// offset specified by o, or an error if they are invalid.
+func (o *Options) params() (litWidth, maxWidth, early int, err error) {
+	litWidth, maxWidth = 8, 12
+	if o != nil {
+		if o.LitWidth != 0 {
+			litWidth = o.LitWidth
+		}
+		if o.MaxWidth != 0 {
+			maxWidth = o.MaxWidth
+		}
+		if o.EarlyChange {
+			early = 1
+		}
+	}
+	if litWidth < 2 || litWidth > 8 {
+		return 0, 0, 0, fmt.Errorf("%w: literal width %d", ErrOptions, litWidth)
+	} else if maxWidth <= litWidth || maxWidth > 16 {
+		return 0, 0, 0, fmt.Errorf("%w: maximum width %d", ErrOptions, maxWidth)
+	}
+	return litWidth, maxWidth, early, nil
+}
+
+// bitOptions returns the options for the underlying bit stream.
+func (o *Options) bitOptions() *bitstream.Options {
+	lsb := o != nil && o.LowBitFirst
+	return &bitstream.Options{LowBitFirst: lsb, FieldLowBitFirst: lsb}
+}
+
+// noCode marks the absence of a previous code.
+const noCode = -1
+
+// A Reader decompresses an LZW stream.  It implements io.Reader.
+type Reader struct {
+	br  *bitstream.Reader
+	err error // if non-nil, the error to report once out is drained
+
+	litWidth, maxWidth, early int
+
+	clear, eoi int // the clear and EOI codes
+	width      int // the current code width
+	hi         int // the next code to be defined
+	last       int // the previous code, or noCode after a clear
+
+	// For each code above eoi that has been defined, its expansion is the
+	// expansion of prefix[code] followed by suffix[code].
+	prefix []uint16
+	suffix []byte
+
+	out  []byte // decoded output not yet delivered
+	opos int    // the offset of the first undelivered byte of out
+}
+
+// NewReader returns a Reader that decompresses the LZW stream read from r.  If
+// r implements io.ByteReader, the Reader does not read any input past the EOI
+// code, so that the caller can continue to read from r afterward.
+func NewReader(r io.Reader, opts *Options) *Reader {
+	bopts := opts.bitOptions()
+	if _, ok := r.(io.ByteReader); ok {
+		bopts.NoReadAhead = true
+	}
+	lr := &Reader{br: bitstream.NewReader(r, bopts)}
+	lr.litWidth, lr.maxWidth, lr.early, lr.err = opts.params()
+	if lr.err == nil {
+		lr.clear = 1 << lr.litWidth
+		lr.eoi = lr.clear + 1
+		lr.prefix = make([]uint16, 1<<lr.maxWidth)
+		lr.suffix = make([]byte, 1<<lr.maxWidth)
+		lr.reset()
+	}
+	return lr
+}
+
+// reset restores the initial state of the code table.
+func (r *Reader) reset() {
+	r.width = r.litWidth + 1
+	r.hi = r.eoi
+	r.last = noCode
+}
+
+// Read implements the io.Reader interface.  It returns io.EOF after the EOI
+// code.  If the input ends before the EOI code, Read reports
+// io.ErrUnexpectedEOF.
+func (r *Reader) Read(data []byte) (int, error) {
+	for r.opos == len(r.out) && r.err == nil {
+		r.out, r.opos = r.out[:0], 0
+		r.err = r.decode()
+	}
+	n := copy(data, r.out[r.opos:])
+	r.opos += n
+	if n == 0 {
+		return 0, r.err
+	}
+	return n, nil
+}
+
+// decode reads the next code from the stream and appends its expansion to
+// r.out.
+func (r *Reader) decode() error {
+	var v uint64
+	if _, err := r.br.ReadBits(r.width, &v); err == io.EOF {
+		return io.ErrUnexpectedEOF // the stream must end with EOI
+	} else if err != nil {
+		return err
+	}
+	code := int(v)
+	switch {
+	case code == r.clear:
+		r.reset()
+		return nil
+	case code == r.eoi:
+		return io.EOF
+	case code < r.clear, code > r.eoi && code < r.hi:
+		r.expand(code)
+	case code == r.hi && r.last != noCode && r.hi < len(r.prefix):
+		// The code being defined is the previous expansion, followed by its
+		// own first byte.
+		r.expand(r.last)
+		r.out = append(r.out, r.first(r.last))
+	default:
+		return &bitstream.OffsetError{
+			Offset: r.br.Offset() - int64(r.width),
+			Err:    fmt.Errorf("%w: invalid code %d", ErrCorrupt, code),
+		}
+	}
+
+	// Define the next code as the previous expansion followed by the first
+	// byte of this one, unless the table is full.
+	if r.hi < len(r.prefix) {
+		if r.last != noCode {
+			r.prefix[r.hi] = uint16(r.last)
+			r.suffix[r.hi] = r.first(code)
+		}
+		r.hi++
+		if r.hi+r.early >= 1<<r.width && r.width < r.maxWidth {
+			r.width++
+		}
+	}
+	r.last = code
+	return nil
+}
+
+// expand appends the expansion of code to r.out.
+func (r *Reader) expand(code int) {
+	start := len(r.out)
+	for code > r.eoi {
+		r.out = append(r.out, r.suffix[code])
+		code = int(r.prefix[code])
+	}
+	r.out = append(r.out, byte(code))
+
+	// The expansion was generated last byte first.
+	for i, j := start, len(r.out)-1; i < j; i, j = i+1, j-1 {
+		r.out[i], r.out[j] = r.out[j], r.out[i]
+	}
+}
+
+// first returns the first byte of the expansion of code.
+func (r *Reader) first(code int) byte {
+	for code > r.eoi {
+		code = int(r.prefix[code])
+	}
+	return byte(code)
+}
+
+// A Writer compresses data written to it as an LZW stream.  The caller must
+// call Close when finished to write the final codes.
+type Writer struct {
+	bw  *bitstream.Writer
+	err error // if non-nil, the error to report for further writes
+
+	litWidth, maxWidth, early int
+
+	clear, eoi int // the clear and EOI codes
+	width      int // the current code width
+	hi         int // the most recently defined code
+	cur        int // the code for the input not yet written, or noCode
+
+	// The code table maps each defined code, combined with the following
+	// byte, to the code for their concatenation.
+	table map[uint32]uint16
+}
+
+// NewWriter returns a Writer that writes compressed data to w.
+func NewWriter(w io.Writer, opts *Options) *Writer {
+	lw := &Writer{
+		bw:    bitstream.NewWriter(w, opts.bitOptions()),
+		table: make(map[uint32]uint16),
+		cur:   noCode,
+	}
+	lw.litWidth, lw.maxWidth, lw.early, lw.err = opts.params()
+	lw.clear = 1 << lw.litWidth
+	lw.eoi = lw.clear + 1
+	lw.width = lw.litWidth + 1
+	return lw
+}
+
+// Write implements the io.Writer interface.  It reports the number of bytes
+// of data accepted for compression.  It is an error if any byte of data does
+// not fit in the literal width.
+func (w *Writer) Write(data []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	for i, b := range data {
+		if int(b) >= w.clear {
+			return i, fmt.Errorf("lzw: literal %d does not fit in %d bits", b, w.litWidth)
+		}
+		if w.cur == noCode {
+			// This is the start of the stream.
+			if err := w.writeClear(); err != nil {
+				w.err = err
+				return i, err
+			}
+			w.cur = int(b)
+			continue
+		}
+
+		// Extend the current string if possible.  Otherwise, write its code
+		// and begin a new string with this byte.
+		key := uint32(w.cur)<<8 | uint32(b)
+		if code, ok := w.table[key]; ok {
+			w.cur = int(code)
+			continue
+		}
+		if err := w.writeCode(w.cur); err != nil {
+			w.err = err
+			return i, err
+		}
+		if w.hi > w.eoi {
+			w.table[key] = uint16(w.hi)
+		}
+		w.cur = int(b)
+	}
+	return len(data), nil
+}
+
+// Close writes the code for any remaining input and the EOI code, and flushes
+// the output.  It does not close the underlying writer.  After Close succeeds,
+// further writes report ErrClosed.
+func (w *Writer) Close() error {
+	if w.err == ErrClosed {
+		return nil
+	} else if w.err != nil {
+		return w.err
+	}
+	var err error
+	if w.cur == noCode {
+		err = w.writeClear()
+	} else {
+		err = w.writeCode(w.cur)
+	}
+	if err == nil {
+		_, err = w.bw.WriteBits(w.width, uint64(w.eoi))
+	}
+	if err == nil {
+		err = w.bw.Flush()
+	}
+	if err != nil {
+		w.err = err
+		return err
+	}
+	w.err = ErrClosed
+	return nil
+}
+
+// writeClear writes a clear code, and resets the code table.
+func (w *Writer) writeClear() error {
+	if _, err := w.bw.WriteBits(w.width, uint64(w.clear)); err != nil {
+		return err
+	}
+	w.width = w.litWidth + 1
+	w.hi = w.eoi
+	clear(w.table)
+	return nil
+}
+
+// writeCode writes code, and advances the next code to be defined, mirroring
+// the decoder.  If this fills the table, writeCode also writes a clear code,
+// and sets w.hi to eoi so that the caller does not define a new code.
+func (w *Writer) writeCode(code int) error {
+	if _, err := w.bw.WriteBits(w.width, uint64(code)); err != nil {
+		return err
+	}
+	w.hi++
+	if w.hi == 1<<w.maxWidth-1 {
+		return w.writeClear()
+	}
+	if w.hi+w.early == 1<<w.width {
+		w.width++
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package lzw_test
+
+import (
+	"bytes"
+	stdlzw "compress/lzw"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/bitstream/internal/bitutil"
+	"github.com/creachadair/bitstream/lzw"
+)
+
+// testInputs returns a collection of inputs whose bytes fit in litWidth bits.
+func testInputs(litWidth int) map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	mask := byte(1<<litWidth - 1)
+
+	random := make([]byte, 50000)
+	rng.Read(random)
+	for i := range random {
+		random[i] &= mask
+	}
+
+	// A small vocabulary gives many repeated strings.
+	words := strings.Fields("the quick brown fox jumps over a lazy dog")
+	var text []byte
+	for len(text) < 100000 {
+		for _, c := range []byte(words[rng.Intn(len(words))] + " ") {
+			text = append(text, c&mask)
+		}
+	}
+	return map[string][]byte{
+		"empty":  nil,
+		"byte":   {1},
+		"pair":   {2, 2},
+		"zeroes": make([]byte, 100000),
+		"random": random,
+		"text":   text,
+	}
+}
+
+// compress returns the compression of input with the given options.
+func compress(t *testing.T, input []byte, opts *lzw.Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := lzw.NewWriter(&buf, opts)
+	// Write in uneven pieces, to exercise the boundaries.
+	for rest := input; len(rest) > 0; {
+		n := min(len(rest), 1001)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatalf("Write: unexpected error: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestStandard(t *testing.T) {
+	// Without early change, the output matches compress/lzw exactly, and each
+	// package can decompress the output of the other.
+	for _, lsb := range []bool{false, true} {
+		order := stdlzw.MSB
+		if lsb {
+			order = stdlzw.LSB
+		}
+		for _, lw := range []int{2, 5, 8} {
+			for name, input := range testInputs(lw) {
+				tag := fmt.Sprintf("%s lsb=%v litWidth=%d", name, lsb, lw)
+
+				var std bytes.Buffer
+				sw := stdlzw.NewWriter(&std, order, lw)
+				sw.Write(input)
+				sw.Close()
+
+				opts := &lzw.Options{LowBitFirst: lsb, LitWidth: lw}
+				if got := compress(t, input, opts); !bytes.Equal(got, std.Bytes()) {
+					t.Errorf("%s: output differs from compress/lzw (%d bytes, want %d)", tag, len(got), std.Len())
+				}
+
+				got, err := io.ReadAll(lzw.NewReader(bytes.NewReader(std.Bytes()), opts))
+				if err != nil {
+					t.Errorf("%s: ReadAll: unexpected error: %v", tag, err)
+				} else if !bytes.Equal(got, input) {
+					t.Errorf("%s: got %d bytes, want %d", tag, len(got), len(input))
+				}
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, input := range testInputs(8) {
+		for _, opts := range []*lzw.Options{
+			nil,
+			{LowBitFirst: true},
+			{EarlyChange: true},
+			{LowBitFirst: true, EarlyChange: true},
+			{MaxWidth: 9},
+			{MaxWidth: 16, EarlyChange: true},
+		} {
+			data := compress(t, input, opts)
+			got, err := io.ReadAll(lzw.NewReader(bytes.NewReader(data), opts))
+			if err != nil {
+				t.Errorf("%s %+v: ReadAll: unexpected error: %v", name, opts, err)
+			} else if !bytes.Equal(got, input) {
+				t.Errorf("%s %+v: got %d bytes, want %d", name, opts, len(got), len(input))
+			}
+		}
+	}
+}
+
+func TestEarlyChange(t *testing.T) {
+	// With 2-bit literals, codes start at 3 bits, and the codes 4 (clear) and 5
+	// (EOI) are reserved.  Each code after the first defines a new code, from 6
+	// upward.  Without early change, the width grows to 4 bits once code 7 has
+	// been defined; with early change, once code 6 has been defined.
+	tests := []struct {
+		early bool
+		want  string
+	}{
+		// clear, 0, 1, 2, 3, EOI
+		{false, "100 000 001 010 0011 0101"},
+		{true, "100 000 001 0010 0011 0101"},
+	}
+	for _, test := range tests {
+		data := compress(t, []byte{0, 1, 2, 3}, &lzw.Options{LitWidth: 2, EarlyChange: test.early})
+		want := strings.ReplaceAll(test.want, " ", "")
+		want += strings.Repeat("0", 8*len(data)-len(want))
+		if got := bitutil.BitString(data); got != want {
+			t.Errorf("EarlyChange=%v: got %s, want %s", test.early, got, want)
+		}
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	// The Reader does not consume input past the EOI code when the source is
+	// an io.ByteReader.
+	data := compress(t, []byte("some compressed data, some compressed data"), nil)
+	src := bytes.NewReader(append(data, "trailer"...))
+	if _, err := io.ReadAll(lzw.NewReader(src, nil)); err != nil {
+		t.Fatalf("ReadAll: unexpected error: %v", err)
+	}
+	if rest, _ := io.ReadAll(src); string(rest) != "trailer" {
+		t.Errorf("Remaining input: got %q, want %q", rest, "trailer")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"empty", "", io.ErrUnexpectedEOF},
+		{"no EOI", "\x80\x00", io.ErrUnexpectedEOF}, // clear, literal 0
+
+		// After a clear, the next code must be a literal.
+		{"undefined code", "\x80\x40\x80", lzw.ErrCorrupt}, // clear, 258
+	}
+	for _, test := range tests {
+		_, err := io.ReadAll(lzw.NewReader(strings.NewReader(test.input), nil))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	for _, opts := range []*lzw.Options{{LitWidth: 1}, {LitWidth: 9}, {LitWidth: 8, MaxWidth: 8}, {MaxWidth: 17}} {
+		if _, err := lzw.NewReader(strings.NewReader(""), opts).Read(make([]byte, 1)); !errors.Is(err, lzw.ErrOptions) {
+			t.Errorf("Read %+v: got %v, want %v", opts, err, lzw.ErrOptions)
+		}
+		if _, err := lzw.NewWriter(io.Discard, opts).Write([]byte{0}); !errors.Is(err, lzw.ErrOptions) {
+			t.Errorf("Write %+v: got %v, want %v", opts, err, lzw.ErrOptions)
+		}
+	}
+
+	// Literals must fit in the literal width.
+	w := lzw.NewWriter(io.Discard, &lzw.Options{LitWidth: 4})
+	if n, err := w.Write([]byte{1, 2, 16}); err == nil || n != 2 {
+		t.Errorf("Write: got (%d, %v), want (2, error)", n, err)
+	}
+
+	// Writes after Close are rejected.
+	w = lzw.NewWriter(io.Discard, nil)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, lzw.ErrClosed) {
+		t.Errorf("Write after Close: got %v, want %v", err, lzw.ErrClosed)
+	}
+}
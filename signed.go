@@ -0,0 +1,161 @@
+package bitstream
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// A SignMode specifies how signed values are represented in a bit field.
+type SignMode int
+
+const (
+	// TwosComplement represents -v as the complement of v plus one.
+	TwosComplement SignMode = iota
+
+	// SignMagnitude represents a value as a sign bit (1 for negative) followed
+	// by the magnitude of the value.
+	SignMagnitude
+
+	// OnesComplement represents -v as the bitwise complement of v.
+	OnesComplement
+
+	// OffsetBinary (or excess-K) represents v as the unsigned value v + K,
+	// where K is half the range of the field.
+	OffsetBinary
+)
+
+// String returns the name of the sign mode.
+func (m SignMode) String() string {
+	switch m {
+	case TwosComplement:
+		return "TwosComplement"
+	case SignMagnitude:
+		return "SignMagnitude"
+	case OnesComplement:
+		return "OnesComplement"
+	case OffsetBinary:
+		return "OffsetBinary"
+	default:
+		return "SignMode(" + strconv.Itoa(int(m)) + ")"
+	}
+}
+
+// valid reports whether m is one of the defined sign modes.
+func (m SignMode) valid() bool { return m >= TwosComplement && m <= OffsetBinary }
+
+// Range returns the smallest and largest values representable in a field of
+// count bits using mode m, for 1 ≤ count ≤ 64.
+func (m SignMode) Range(count int) (lo, hi int64) {
+	hi = int64(uint64(1)<<(count-1) - 1)
+	if m == SignMagnitude || m == OnesComplement {
+		return -hi, hi
+	}
+	return -hi - 1, hi
+}
+
+// decode returns the signed value represented by the low-order count bits of
+// u using mode m.
+func (m SignMode) decode(count int, u uint64) int64 {
+	sign := u >> (count - 1) & 1
+	switch m {
+	case SignMagnitude:
+		mag := int64(u & (1<<(count-1) - 1))
+		if sign != 0 {
+			return -mag
+		}
+		return mag
+	case OnesComplement:
+		if sign != 0 {
+			return -int64(^u & (1<<count - 1))
+		}
+		return int64(u)
+	case OffsetBinary:
+		return int64(u - 1<<(count-1))
+	default:
+		shift := 64 - count
+		return int64(u<<shift) >> shift
+	}
+}
+
+// encode returns the low-order count bits representing v using mode m.  The
+// caller must ensure v is in range.
+func (m SignMode) encode(count int, v int64) uint64 {
+	mask := uint64(1)<<count - 1
+	switch m {
+	case SignMagnitude:
+		if v < 0 {
+			return 1<<(count-1) | uint64(-v)
+		}
+		return uint64(v)
+	case OnesComplement:
+		if v < 0 {
+			return ^uint64(-v) & mask
+		}
+		return uint64(v)
+	case OffsetBinary:
+		return (uint64(v) + 1<<(count-1)) & mask
+	default:
+		return uint64(v) & mask
+	}
+}
+
+// A RangeError is reported when a value does not fit in the requested field.
+type RangeError struct {
+	Count  int    // the width of the field in bits
+	Value  uint64 // the value, or its two's complement if Signed is true
+	Signed bool   // whether Value should be interpreted as signed
+
+	// For a value that may be wider than 64 bits, as written by WriteWide,
+	// WriteBig, or WriteUint128, the complete value.  In that case Value
+	// holds its low-order 64 bits.
+	Big *big.Int
+}
+
+// Error satisfies the error interface.
+func (e *RangeError) Error() string {
+	if e.Big != nil {
+		return fmt.Sprintf("value %v does not fit in %d bits", e.Big, e.Count)
+	} else if e.Signed {
+		return fmt.Sprintf("value %d does not fit in %d bits", int64(e.Value), e.Count)
+	}
+	return fmt.Sprintf("value %d does not fit in %d bits", e.Value, e.Count)
+}
+
+// ReadSigned reads the next count bits from the reader and decodes them as a
+// signed value using the specified sign mode.  If v != nil, the result is
+// stored in *v.  It is an error if count < 1 or count > 64.
+//
+// The results follow the same rules as ReadBits, except that *v is modified
+// only if all count bits were read successfully.
+func (r *Reader) ReadSigned(count int, mode SignMode, v *int64) (int, error) {
+	if count < 1 || count > 64 {
+		return 0, offsetError(r.off, ErrCountRange)
+	} else if !mode.valid() {
+		return 0, offsetError(r.off, fmt.Errorf("invalid sign mode %v", mode))
+	}
+	var u uint64
+	n, err := r.ReadBits(count, &u)
+	if err == nil && v != nil {
+		*v = mode.decode(count, u)
+	}
+	return n, err
+}
+
+// WriteSigned encodes v as a count-bit field using the specified sign mode, and
+// appends it to the stream.  It is an error if count < 1 or count > 64.  If v
+// is not representable in count bits with the given mode, WriteSigned reports
+// an error wrapping a *RangeError, and nothing is written.
+//
+// Otherwise, the results follow the same rules as WriteBits.
+func (w *Writer) WriteSigned(count int, mode SignMode, v int64) (int, error) {
+	if count < 1 || count > 64 {
+		return 0, offsetError(w.Offset(), ErrCountRange)
+	} else if !mode.valid() {
+		return 0, offsetError(w.Offset(), fmt.Errorf("invalid sign mode %v", mode))
+	}
+	if lo, hi := mode.Range(count); v < lo || v > hi {
+		return 0, offsetError(w.Offset(), &RangeError{Count: count, Value: uint64(v), Signed: true})
+	}
+	return w.WriteBits(count, mode.encode(count, v))
+}
@@ -0,0 +1,101 @@
+package bitstream
+
+import (
+	"io"
+	"math/bits"
+)
+
+// Unsigned is the set of unsigned integer types supported by ReadUint and
+// WriteUint.
+type Unsigned interface {
+	~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uint | ~uintptr
+}
+
+// Signed is the set of signed integer types supported by ReadInt and WriteInt.
+type Signed interface {
+	~int8 | ~int16 | ~int32 | ~int64 | ~int
+}
+
+// ReadUint reads the next count bits from r as an unsigned value of type T.
+// It is an error if count < 0 or count exceeds the width of T.  If no bits
+// remain, ReadUint returns io.EOF; if fewer than count bits remain, they are
+// consumed and ReadUint reports io.ErrUnexpectedEOF.
+func ReadUint[T Unsigned](r *Reader, count int) (T, error) {
+	var zero T
+	if count < 0 || count > uintWidth[T]() {
+		return zero, offsetError(r.off, ErrCountRange)
+	}
+	var v uint64
+	n, err := r.ReadBits(count, &v)
+	if err != nil {
+		return zero, shortRead(r, n, err)
+	}
+	return T(v), nil
+}
+
+// WriteUint appends v to the stream as a count-bit unsigned field.  It is an
+// error if count < 0 or count exceeds the width of T.  If v does not fit in
+// count bits, WriteUint reports an error wrapping a *RangeError, and nothing
+// is written.  Otherwise, the results follow the same rules as WriteBits.
+func WriteUint[T Unsigned](w *Writer, count int, v T) error {
+	if count < 0 || count > uintWidth[T]() {
+		return offsetError(w.Offset(), ErrCountRange)
+	}
+	if uint64(v)>>count != 0 {
+		return offsetError(w.Offset(), &RangeError{Count: count, Value: uint64(v)})
+	}
+	_, err := w.WriteBits(count, uint64(v))
+	return err
+}
+
+// ReadInt reads the next count bits from r as a two's complement signed value
+// of type T.  It is an error if count < 1 or count exceeds the width of T.
+// Errors are reported as for ReadUint.  For other sign representations, use
+// Reader.ReadSigned.
+func ReadInt[T Signed](r *Reader, count int) (T, error) {
+	var zero T
+	if count < 1 || count > intWidth[T]() {
+		return zero, offsetError(r.off, ErrCountRange)
+	}
+	var v int64
+	n, err := r.ReadSigned(count, TwosComplement, &v)
+	if err != nil {
+		return zero, shortRead(r, n, err)
+	}
+	return T(v), nil
+}
+
+// WriteInt appends v to the stream as a count-bit two's complement signed
+// field.  It is an error if count < 1 or count exceeds the width of T.  If v
+// does not fit in count bits, WriteInt reports an error wrapping a
+// *RangeError, and nothing is written.  For other sign representations, use
+// Writer.WriteSigned.
+func WriteInt[T Signed](w *Writer, count int, v T) error {
+	if count < 1 || count > intWidth[T]() {
+		return offsetError(w.Offset(), ErrCountRange)
+	}
+	_, err := w.WriteSigned(count, TwosComplement, int64(v))
+	return err
+}
+
+// uintWidth returns the width in bits of the unsigned type T.
+func uintWidth[T Unsigned]() int { return bits.Len64(uint64(^T(0))) }
+
+// intWidth returns the width in bits of the signed type T, which is the
+// position of its sign bit plus one.
+func intWidth[T Signed]() int {
+	n := 8
+	for n < 64 && T(1)<<(n-1) > 0 {
+		n *= 2
+	}
+	return n
+}
+
+// shortRead converts an io.EOF error after a read of n bits from r into
+// io.ErrUnexpectedEOF, if n > 0.  Other errors are returned unmodified.
+func shortRead(r *Reader, n int, err error) error {
+	if err == io.EOF && n != 0 {
+		return offsetError(r.off, io.ErrUnexpectedEOF)
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+// Package universal implements universal codes for positive integers over bit
+// streams, including the Elias gamma, delta, and omega codes, and Fibonacci
+// coding.
+//
+// A universal code maps each positive integer to a self-delimiting bit string,
+// whose length grows with the magnitude of the value, without requiring any
+// prior knowledge of the distribution of values.  These codes do not represent
+// zero; callers who need to encode non-negative values typically add 1.
+//
+// Like the other variable-length codes of the bitstream package, these codes
+// are written in stream order, with the most-significant bit of each binary
+// part first, regardless of the FieldLowBitFirst option.
+package universal
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/internal/bitutil"
+)
+
+// ErrZero is reported when asked to encode the value 0.
+var ErrZero = errors.New("universal: value must be positive")
+
+// A Code encodes and decodes positive integers as variable-length codes.
+type Code interface {
+	// Encode appends the code for v to w.  It reports ErrZero if v == 0.
+	Encode(w *bitstream.Writer, v uint64) error
+
+	// Decode reads a code from r and returns the value it encodes.  If the
+	// stream ends before the first bit of a code, Decode returns io.EOF; if it
+	// ends partway through a code, it reports io.ErrUnexpectedEOF.  Codes for
+	// values that do not fit in a uint64 are reported as ErrCodeLength.
+	Decode(r *bitstream.Reader) (uint64, error)
+}
+
+var (
+	// Gamma is the Elias gamma code.  The value v is written as N zero bits
+	// followed by the N+1 bits of v, where N = ⌊log₂ v⌋.
+	Gamma Code = gamma{}
+
+	// Delta is the Elias delta code.  The value v is written as the gamma code
+	// of N+1, followed by the low-order N bits of v, where N = ⌊log₂ v⌋.
+	Delta Code = delta{}
+
+	// Omega is the Elias omega (recursive) code.  The value v is written as a
+	// sequence of groups, each giving the length of the next less one, ending
+	// with the bits of v itself followed by a zero bit.
+	Omega Code = omega{}
+
+	// Fibonacci is the Fibonacci code.  The value v is written as its
+	// Zeckendorf representation, starting with the coefficient of the smallest
+	// Fibonacci number, followed by an extra one bit, so that every code ends
+	// in two consecutive one bits.
+	Fibonacci Code = fibonacci{}
+)
+
+// EncodeAll appends the codes for each element of vs to w, using the code c.
+// It stops at the first error.
+func EncodeAll(w *bitstream.Writer, c Code, vs []uint64) error {
+	for _, v := range vs {
+		if err := c.Encode(w, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeAll reads codes from r using the code c, and stores their values in
+// successive elements of vs.  It returns the number of values decoded, which
+// is len(vs) unless an error occurs.
+func DecodeAll(r *bitstream.Reader, c Code, vs []uint64) (int, error) {
+	for i := range vs {
+		v, err := c.Decode(r)
+		if err != nil {
+			return i, err
+		}
+		vs[i] = v
+	}
+	return len(vs), nil
+}
+
+type gamma struct{}
+
+func (gamma) Encode(w *bitstream.Writer, v uint64) error {
+	if v == 0 {
+		return ErrZero
+	}
+	// The leading 1 bit of v terminates the run of zeroes.
+	n := bits.Len64(v) - 1
+	if err := w.WriteUnary(false, n); err != nil {
+		return err
+	}
+	return writeLow(w, n, v)
+}
+
+func (gamma) Decode(r *bitstream.Reader) (uint64, error) {
+	n, err := r.ReadUnary(false, 63)
+	if err != nil {
+		return 0, err
+	}
+	v, err := readLow(r, n)
+	if err != nil {
+		return 0, bitutil.NoEOF(err)
+	}
+	return 1<<n | v, nil
+}
+
+type delta struct{}
+
+func (delta) Encode(w *bitstream.Writer, v uint64) error {
+	if v == 0 {
+		return ErrZero
+	}
+	n := bits.Len64(v) - 1
+	if err := Gamma.Encode(w, uint64(n+1)); err != nil {
+		return err
+	}
+	return writeLow(w, n, v)
+}
+
+func (delta) Decode(r *bitstream.Reader) (uint64, error) {
+	n, err := Gamma.Decode(r)
+	if err != nil {
+		return 0, err
+	} else if n > 64 {
+		return 0, bitstream.ErrCodeLength
+	}
+	v, err := readLow(r, int(n-1))
+	if err != nil {
+		return 0, bitutil.NoEOF(err)
+	}
+	return 1<<(n-1) | v, nil
+}
+
+type omega struct{}
+
+func (omega) Encode(w *bitstream.Writer, v uint64) error {
+	if v == 0 {
+		return ErrZero
+	}
+
+	// Each group encodes the length of the following group, less one, so
+	// generate the groups from last to first.
+	var groups [8]uint64 // lengths shrink logarithmically, so this is plenty
+	var n int
+	for ; v > 1; v = uint64(bits.Len64(v) - 1) {
+		groups[n] = v
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		if err := w.WriteBit(true); err != nil {
+			return err
+		}
+		if err := writeLow(w, bits.Len64(groups[i])-1, groups[i]); err != nil {
+			return err
+		}
+	}
+	return w.WriteBit(false)
+}
+
+func (omega) Decode(r *bitstream.Reader) (uint64, error) {
+	v := uint64(1)
+	for first := true; ; first = false {
+		bit, err := r.ReadBit()
+		if err != nil {
+			if first {
+				return 0, err
+			}
+			return 0, bitutil.NoEOF(err)
+		} else if !bit {
+			return v, nil
+		} else if v > 63 {
+			return 0, bitstream.ErrCodeLength
+		}
+
+		// The group has v+1 bits, of which we already have the leading 1.
+		next, err := readLow(r, int(v))
+		if err != nil {
+			return 0, bitutil.NoEOF(err)
+		}
+		v = 1<<v | next
+	}
+}
+
+// writeLow appends the low-order n bits of v to w, most-significant first.
+// A truncated binary code for 2^n values is exactly those bits, written in
+// stream order.
+func writeLow(w *bitstream.Writer, n int, v uint64) error {
+	return w.WriteTruncated(1<<n, v&(1<<n-1))
+}
+
+// readLow reads n bits from r, as written by writeLow.
+func readLow(r *bitstream.Reader, n int) (uint64, error) {
+	return r.ReadTruncated(1 << n)
+}
+
+// fibs holds the Fibonacci numbers F(2) = 1, F(3) = 2, ... that fit in a
+// uint64.  These are the place values of the Zeckendorf representation.
+var fibs = func() []uint64 {
+	fs := []uint64{1, 2}
+	for {
+		a, b := fs[len(fs)-2], fs[len(fs)-1]
+		s, carry := bits.Add64(a, b, 0)
+		if carry != 0 {
+			return fs
+		}
+		fs = append(fs, s)
+	}
+}()
+
+type fibonacci struct{}
+
+func (fibonacci) Encode(w *bitstream.Writer, v uint64) error {
+	if v == 0 {
+		return ErrZero
+	}
+
+	// Find the Zeckendorf representation greedily, from the largest place
+	// value down, recording which place values are used.
+	var used [2]uint64
+	for i := len(fibs) - 1; i >= 0 && v > 0; i-- {
+		if fibs[i] <= v {
+			v -= fibs[i]
+			used[i/64] |= 1 << (i % 64)
+		}
+	}
+
+	// Write the code from the smallest place value up, as runs of zeroes each
+	// terminated by a one, followed by the extra terminating one bit.
+	prev := -1
+	for i := range fibs {
+		if used[i/64]&(1<<(i%64)) != 0 {
+			if err := w.WriteUnary(false, i-prev-1); err != nil {
+				return err
+			}
+			prev = i
+		}
+	}
+	return w.WriteBit(true)
+}
+
+func (fibonacci) Decode(r *bitstream.Reader) (uint64, error) {
+	// Each run of zeroes ends with a one bit marking the next place value in
+	// the representation.  The code ends when a run is empty, i.e., when two
+	// one bits occur consecutively.
+	var v uint64
+	for i := 0; ; i++ {
+		z, err := r.ReadUnary(false, max(len(fibs)-1-i, 0))
+		if err != nil {
+			if i == 0 {
+				return 0, err
+			}
+			return 0, bitutil.NoEOF(err)
+		} else if z == 0 && i > 0 {
+			return v, nil
+		}
+		i += z
+		var carry uint64
+		v, carry = bits.Add64(v, fibs[i], 0)
+		if carry != 0 {
+			return 0, bitstream.ErrCodeLength
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package universal_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/creachadair/bitstream"
+	"github.com/creachadair/bitstream/internal/bitutil"
+	"github.com/creachadair/bitstream/universal"
+)
+
+var codes = []struct {
+	name string
+	code universal.Code
+}{
+	{"Gamma", universal.Gamma},
+	{"Delta", universal.Delta},
+	{"Omega", universal.Omega},
+	{"Fibonacci", universal.Fibonacci},
+}
+
+func TestCodes(t *testing.T) {
+	tests := []struct {
+		code universal.Code
+		v    uint64
+		want string // bits
+	}{
+		{universal.Gamma, 1, "1"},
+		{universal.Gamma, 2, "010"},
+		{universal.Gamma, 5, "00101"},
+		{universal.Gamma, 12, "0001100"},
+		{universal.Gamma, 17, "000010001"},
+		{universal.Delta, 1, "1"},
+		{universal.Delta, 2, "0100"},
+		{universal.Delta, 10, "00100010"},
+		{universal.Delta, 17, "001010001"},
+		{universal.Omega, 1, "0"},
+		{universal.Omega, 2, "100"},
+		{universal.Omega, 4, "101000"},
+		{universal.Omega, 16, "10100100000"},
+		{universal.Omega, 100, "1011011001000"},
+		{universal.Fibonacci, 1, "11"},
+		{universal.Fibonacci, 2, "011"},
+		{universal.Fibonacci, 4, "1011"},
+		{universal.Fibonacci, 12, "101011"},
+		{universal.Fibonacci, 65, "0100100011"},
+	}
+
+	// The codes are written in stream order regardless of field order.
+	for _, opt := range []*bitstream.Options{nil, {FieldLowBitFirst: true}} {
+		for _, test := range tests {
+			var buf bytes.Buffer
+			w := bitstream.NewWriter(&buf, opt)
+			if err := test.code.Encode(w, test.v); err != nil {
+				t.Errorf("%T %+v Encode(%d): unexpected error: %v", test.code, opt, test.v, err)
+				continue
+			}
+			if got := w.Offset(); got != int64(len(test.want)) {
+				t.Errorf("%T %+v Encode(%d): wrote %d bits, want %d", test.code, opt, test.v, got, len(test.want))
+			}
+			w.Flush()
+			if got := bitutil.BitString(buf.Bytes())[:len(test.want)]; got != test.want {
+				t.Errorf("%T %+v Encode(%d): got %s, want %s", test.code, opt, test.v, got, test.want)
+			}
+
+			r := bitstream.NewReader(&buf, opt)
+			if got, err := test.code.Decode(r); err != nil || got != test.v {
+				t.Errorf("%T %+v Decode: got %d, %v; want %d, nil", test.code, opt, got, err, test.v)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range codes {
+		for _, opt := range []*bitstream.Options{
+			{},
+			{LowBitFirst: true},
+			{LowBitFirst: true, FieldLowBitFirst: true},
+		} {
+
+			// Values with random magnitudes, so that all code lengths are covered.
+			roundTrip := func(vs []uint64, shifts []uint8) bool {
+				for i := range vs {
+					if i < len(shifts) {
+						vs[i] >>= shifts[i] % 64
+					}
+					vs[i] = max(vs[i], 1)
+				}
+				var buf bytes.Buffer
+				w := bitstream.NewWriter(&buf, opt)
+				if err := universal.EncodeAll(w, c.code, vs); err != nil {
+					t.Logf("EncodeAll: unexpected error: %v", err)
+					return false
+				}
+				w.Flush()
+
+				r := bitstream.NewReader(&buf, opt)
+				got := make([]uint64, len(vs))
+				if n, err := universal.DecodeAll(r, c.code, got); err != nil || n != len(vs) {
+					t.Logf("DecodeAll: got %d, %v; want %d, nil", n, err, len(vs))
+					return false
+				}
+				return slices.Equal(got, vs)
+			}
+			if err := quick.Check(roundTrip, nil); err != nil {
+				t.Errorf("%s (%+v): %v", c.name, *opt, err)
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, c := range codes {
+		// The extreme values must round trip.
+		vs := []uint64{1, math.MaxUint64, 1 << 63, 1<<63 - 1, 2}
+		var buf bytes.Buffer
+		w := bitstream.NewWriter(&buf, nil)
+		if err := universal.EncodeAll(w, c.code, vs); err != nil {
+			t.Fatalf("%s EncodeAll: unexpected error: %v", c.name, err)
+		}
+		w.Flush()
+		got := make([]uint64, len(vs))
+		if _, err := universal.DecodeAll(bitstream.NewReader(&buf, nil), c.code, got); err != nil {
+			t.Errorf("%s DecodeAll: unexpected error: %v", c.name, err)
+		} else if !slices.Equal(got, vs) {
+			t.Errorf("%s DecodeAll: got %v, want %v", c.name, got, vs)
+		}
+
+		// Zero is not encodable.
+		if err := c.code.Encode(w, 0); !errors.Is(err, universal.ErrZero) {
+			t.Errorf("%s Encode(0): got %v, want %v", c.name, err, universal.ErrZero)
+		}
+
+		// An empty stream reports EOF, and a truncated one an unexpected EOF.
+		if _, err := c.code.Decode(bitstream.NewReader(strings.NewReader(""), nil)); err != io.EOF {
+			t.Errorf("%s Decode(empty): got %v, want EOF", c.name, err)
+		}
+	}
+
+	// Codes for values that are too large are rejected.
+	tests := []struct {
+		code  universal.Code
+		input string
+	}{
+		{universal.Gamma, strings.Repeat("\x00", 8) + "\xff"},
+		{universal.Delta, "\x00\x41\xff"}, // length 65
+		{universal.Omega, "\xaf\xff" + strings.Repeat("\xff", 9)},
+		{universal.Fibonacci, strings.Repeat("\xaa", 12) + "\xc0"},
+	}
+	for _, test := range tests {
+		r := bitstream.NewReader(strings.NewReader(test.input), nil)
+		if v, err := test.code.Decode(r); !errors.Is(err, bitstream.ErrCodeLength) {
+			t.Errorf("%T Decode(%q): got %d, %v; want %v", test.code, test.input, v, err, bitstream.ErrCodeLength)
+		}
+	}
+	for _, test := range []struct {
+		code  universal.Code
+		input string
+	}{
+		{universal.Gamma, "\x01"},
+		{universal.Delta, "\x38"},
+		{universal.Omega, "\xff"},
+		{universal.Fibonacci, "\x55"},
+	} {
+		r := bitstream.NewReader(strings.NewReader(test.input), nil)
+		if _, err := test.code.Decode(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%T Decode(%q): got %v, want %v", test.code, test.input, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
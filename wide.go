@@ -0,0 +1,334 @@
+package bitstream
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/big"
+)
+
+// ReadWide reads the next (up to) count bits from the reader into dst, which
+// holds them as a big-endian unsigned integer aligned to the end of the slice.
+// Bits of dst not occupied by the field are set to zero.  Unlike ReadBits,
+// count may exceed 64.  It is an error if count < 0 or count > 8*len(dst).
+//
+// If err == nil, n == count.
+// If err == io.EOF, 0 ≤ n < count, and the bits read occupy the low-order n
+// bits of dst.
+// For any other error, n reports how many bits were consumed before the error
+// occurred, and the contents of dst are unspecified.
+func (r *Reader) ReadWide(count int, dst []byte) (n int, err error) {
+	if count < 0 || count > 8*len(dst) {
+		return 0, offsetError(r.off, ErrCountRange)
+	}
+	clear(dst)
+
+	// When the low-order bit of a field comes first, read the low-order chunks
+	// first, and a short read leaves the bits in place.
+	if r.opts.fieldLowBitFirst() {
+		for n < count {
+			var v uint64
+			nr, err := r.ReadBits(min(count-n, 64), &v)
+			orBits(dst, n, nr, v)
+			n += nr
+			if err != nil {
+				return n, err
+			}
+		}
+		return n, nil
+	}
+
+	// Read the odd-sized high-order chunk first, so that each of the remaining
+	// 64-bit chunks lands on a byte boundary in dst.
+	for k := (count-1)%64 + 1; n < count; k = 64 {
+		var v uint64
+		nr, err := r.ReadBits(k, &v)
+		n += nr
+		if err != nil {
+			if err == io.EOF {
+				// Move the complete chunks down to make room for the partial one.
+				shiftRight(dst, count-n)
+				orBits(dst, 0, nr, v)
+			}
+			return n, err
+		}
+		orBits(dst, count-n, k, v)
+	}
+	return n, nil
+}
+
+// WriteWide appends the low-order count bits of src, which holds a big-endian
+// unsigned integer aligned to the end of the slice, to the stream.  Unlike
+// WriteBits, count may exceed 64.  It is an error if count < 0 or count >
+// 8*len(src).  As for WriteBits, any bits of src above count are ignored,
+// unless the Strict option is set, in which case WriteWide reports an error
+// wrapping a *RangeError and writes nothing.
+//
+// Fields wider than 64 bits are written in pieces, so if an error occurs the
+// returned count reports how many bits of the field were added to the stream.
+func (w *Writer) WriteWide(count int, src []byte) (n int, err error) {
+	if count < 0 || count > 8*len(src) {
+		return 0, offsetError(w.Offset(), ErrCountRange)
+	} else if err := w.checkWide(count, src); err != nil {
+		return 0, err
+	}
+	if w.opts.fieldLowBitFirst() {
+		for n < count {
+			k := min(count-n, 64)
+			nw, err := w.WriteBits(k, getBits(src, n, k))
+			if err != nil {
+				return n, err
+			}
+			n += nw
+		}
+		return n, nil
+	}
+	for k := (count-1)%64 + 1; n < count; k = 64 {
+		nw, err := w.WriteBits(k, getBits(src, count-n-k, k))
+		if err != nil {
+			return n, err
+		}
+		n += nw
+	}
+	return n, nil
+}
+
+// ReadBig reads the next (up to) count bits from the reader into z, as an
+// unsigned integer.  Unlike ReadBits, count may exceed 64.  It is an error if
+// count < 0.  The results follow the same rules as ReadWide.  Storage for z
+// grows with the bits actually read, so a large count is not an error in
+// itself, and a short stream reports io.EOF.
+func (r *Reader) ReadBig(count int, z *big.Int) (n int, err error) {
+	if count < 0 {
+		return 0, offsetError(r.off, ErrCountRange)
+	}
+	var buf []byte // the complete chunks read, as a big-endian integer
+
+	// When the low-order bit of a field comes first, the chunks are collected
+	// and assembled from the high-order end once the reads are done.
+	if r.opts.fieldLowBitFirst() {
+		var chunks []uint64
+		for n < count && err == nil {
+			var v uint64
+			var nr int
+			nr, err = r.ReadBits(min(count-n, 64), &v)
+			chunks = append(chunks, v)
+			n += nr
+		}
+		for i := len(chunks) - 1; i >= 0; i-- {
+			buf = binary.BigEndian.AppendUint64(buf, chunks[i])
+		}
+		z.SetBytes(buf)
+		return n, err
+	}
+
+	// Otherwise, each chunk is below those already read.  A short chunk is
+	// shifted in after the complete ones.
+	for k := (count-1)%64 + 1; n < count; k = 64 {
+		var v uint64
+		nr, err := r.ReadBits(k, &v)
+		n += nr
+		if err != nil {
+			z.SetBytes(buf)
+			z.Lsh(z, uint(nr))
+			z.Or(z, new(big.Int).SetUint64(v))
+			return n, err
+		}
+		buf = binary.BigEndian.AppendUint64(buf, v)
+	}
+	z.SetBytes(buf)
+	return n, nil
+}
+
+// WriteBig appends the low-order count bits of z to the stream.  If z is
+// negative, its two's complement representation is used.  Unlike WriteBits,
+// count may exceed 64.  It is an error if count < 0.  With the Strict option,
+// it is an error if z is not representable in count bits, either as an
+// unsigned value or, if z is negative, in two's complement.  The results
+// follow the same rules as WriteWide.
+func (w *Writer) WriteBig(count int, z *big.Int) (int, error) {
+	if count < 0 {
+		return 0, offsetError(w.Offset(), ErrCountRange)
+	}
+	if w.opts != nil && w.opts.Strict {
+		// A negative z fits if -z-1 fits in the count-1 bits below the sign.
+		mag, width := z, count
+		if z.Sign() < 0 {
+			mag, width = new(big.Int).Not(z), count-1
+		}
+		if mag.BitLen() > width {
+			low := new(big.Int).And(z, new(big.Int).SetUint64(math.MaxUint64))
+			return 0, offsetError(w.Offset(), &RangeError{
+				Count: count, Value: low.Uint64(), Signed: z.Sign() < 0, Big: new(big.Int).Set(z),
+			})
+		}
+	}
+
+	// Only the low-order bits of z up to its sign need storage.  The bits of
+	// the field above them repeat the sign, and are written as a run.
+	m := min(count, z.BitLen()+1)
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(m))
+	mask.Sub(mask, big.NewInt(1))
+	buf := make([]byte, bitsToBytes(m))
+	mask.And(mask, z).FillBytes(buf)
+
+	neg := z.Sign() < 0
+	if w.opts.fieldLowBitFirst() {
+		n, err := w.WriteWide(m, buf)
+		if err != nil {
+			return n, err
+		}
+		nr, err := w.writeRun(count-m, neg)
+		return n + nr, err
+	}
+	n, err := w.writeRun(count-m, neg)
+	if err != nil {
+		return n, err
+	}
+	nw, err := w.WriteWide(m, buf)
+	return n + nw, err
+}
+
+// writeRun appends count copies of bit to the stream, and returns the number
+// of bits written.
+func (w *Writer) writeRun(count int, bit bool) (n int, err error) {
+	var run uint64
+	if bit {
+		run = ^run
+	}
+	for n < count {
+		k := min(count-n, 64)
+		if _, err := w.writeBits(k, run>>(64-k)); err != nil {
+			return n, err
+		}
+		n += k
+	}
+	return n, nil
+}
+
+// ReadUint128 reads the next (up to) count bits from the reader into *v,
+// where they occupy the low-order count bits of the 128-bit unsigned integer
+// whose high-order word is v[0] and whose low-order word is v[1].  It is an
+// error if count < 0 or count > 128.  The results follow the same rules as
+// ReadWide.
+func (r *Reader) ReadUint128(count int, v *[2]uint64) (n int, err error) {
+	if count < 0 || count > 128 {
+		return 0, offsetError(r.off, ErrCountRange)
+	}
+	if count <= 64 {
+		v[0] = 0
+		return r.ReadBits(count, &v[1])
+	}
+	var hi, lo uint64
+	if r.opts.fieldLowBitFirst() {
+		n1, err := r.ReadBits(64, &lo)
+		if err != nil {
+			v[0], v[1] = 0, lo
+			return n1, err
+		}
+		n2, err := r.ReadBits(count-64, &hi)
+		v[0], v[1] = hi, lo
+		return n1 + n2, err
+	}
+	n1, err := r.ReadBits(count-64, &hi)
+	if err != nil {
+		v[0], v[1] = 0, hi
+		return n1, err
+	}
+	n2, err := r.ReadBits(64, &lo)
+	v[0], v[1] = hi>>(64-n2), hi<<n2|lo
+	return n1 + n2, err
+}
+
+// WriteUint128 appends the low-order count bits of the 128-bit unsigned
+// integer whose high-order word is v[0] and whose low-order word is v[1] to
+// the stream.  It is an error if count < 0 or count > 128.  The results follow
+// the same rules as WriteWide.
+func (w *Writer) WriteUint128(count int, v [2]uint64) (int, error) {
+	if count < 0 || count > 128 {
+		return 0, offsetError(w.Offset(), ErrCountRange)
+	}
+	if w.opts != nil && w.opts.Strict {
+		var buf [16]byte
+		binary.BigEndian.PutUint64(buf[:8], v[0])
+		binary.BigEndian.PutUint64(buf[8:], v[1])
+		if err := w.checkWide(count, buf[:]); err != nil {
+			return 0, err
+		}
+	}
+	if count <= 64 {
+		return w.WriteBits(count, v[1]&(1<<count-1))
+	}
+	if w.opts.fieldLowBitFirst() {
+		n1, err := w.WriteBits(64, v[1])
+		if err != nil {
+			return 0, err
+		}
+		n2, err := w.WriteBits(count-64, v[0]&(1<<(count-64)-1))
+		return n1 + n2, err
+	}
+	n1, err := w.WriteBits(count-64, v[0]&(1<<(count-64)-1))
+	if err != nil {
+		return 0, err
+	}
+	n2, err := w.WriteBits(64, v[1])
+	return n1 + n2, err
+}
+
+// checkWide reports an error wrapping a *RangeError if the Strict option is
+// set and src, a big-endian unsigned integer, has bits set above count.
+func (w *Writer) checkWide(count int, src []byte) error {
+	if w.opts == nil || !w.opts.Strict {
+		return nil
+	}
+	excess := false
+	nb := len(src) - bitsToBytes(count) // bytes wholly above the field
+	for _, b := range src[:nb] {
+		excess = excess || b != 0
+	}
+	if k := count % 8; k != 0 && src[nb]>>k != 0 {
+		excess = true
+	}
+	if !excess {
+		return nil
+	}
+	z := new(big.Int).SetBytes(src)
+	return offsetError(w.Offset(), &RangeError{Count: count, Value: z.Uint64(), Big: z})
+}
+
+// orBits sets the bits of buf starting lsb bits from the end of the slice to
+// the low-order count bits of v, which must be zero above count.  The lsb
+// offset must be a multiple of 8.
+func orBits(buf []byte, lsb, count int, v uint64) {
+	for i := len(buf) - 1 - lsb/8; count > 0; i-- {
+		buf[i] |= byte(v)
+		v >>= 8
+		count -= 8
+	}
+}
+
+// getBits returns the count bits of buf starting lsb bits from the end of the
+// slice.  The lsb offset must be a multiple of 8, and count ≤ 64.
+func getBits(buf []byte, lsb, count int) uint64 {
+	var v uint64
+	for i := len(buf) - 1 - lsb/8 - (count-1)/8; i < len(buf)-lsb/8; i++ {
+		v = v<<8 | uint64(buf[i])
+	}
+	return v & (1<<count - 1)
+}
+
+// shiftRight shifts the contents of buf, as a big-endian integer, right by n
+// bits, filling with zeroes.
+func shiftRight(buf []byte, n int) {
+	nbytes, nbits := n/8, uint(n%8)
+	for i := len(buf) - 1; i >= 0; i-- {
+		var v uint16
+		if j := i - nbytes; j >= 0 {
+			v = uint16(buf[j])
+			if j > 0 {
+				v |= uint16(buf[j-1]) << 8
+			}
+		}
+		buf[i] = byte(v >> nbits)
+	}
+}